@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
-	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/configs"
+	configsPkg "github.com/HalexV/pos-go-expert-desafio-rate-limiter/configs"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/redis/limit"
 	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/webserver/handlers"
 	myMiddlewares "github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/webserver/middlewares"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
 	jwtcustomverifiers "github.com/HalexV/pos-go-expert-desafio-rate-limiter/pkg/jwt-custom-verifiers"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,12 +19,65 @@ import (
 )
 
 func main() {
-	configs, err := configs.LoadConfig(".")
+	configs, err := configsPkg.LoadConfig(".")
 	if err != nil {
 		panic(err)
 	}
 
-	rateLimitMiddleware := myMiddlewares.NewRateLimitMiddlewareBuilder()
+	// Um client só, com um pool só, para o middleware e a lista de acesso
+	redisClient, err := redisConfig(configs).NewClient()
+	if err != nil {
+		panic(err)
+	}
+
+	keyNamespace := myMiddlewares.KeyNamespace{Prefix: configs.RedisKeyPrefix, HashTag: configs.RedisKeyHashTag}
+	rateLimitMiddleware := myMiddlewares.NewRateLimitMiddlewareBuilder().
+		WithKeyNamespace(keyNamespace).
+		WithRedisClient(redisClient)
+
+	switch myMiddlewares.RepositoryStrategy(configs.LimitStrategy) {
+	case myMiddlewares.StrategyRedisApproximate:
+		rateLimitMiddleware.WithRedisApproximate(configs.RedisHost, configs.RedisPort)
+	case myMiddlewares.StrategyRedisGCRA:
+		rateLimitMiddleware.WithRedisGCRA(configs.RedisHost, configs.RedisPort)
+	case myMiddlewares.StrategyRedisLeased:
+		rateLimitMiddleware.WithRedisLeased(configs.RedisHost, configs.RedisPort, configs.LimitLeaseFraction)
+	default:
+		rateLimitMiddleware.WithRedis(configs.RedisHost, configs.RedisPort)
+	}
+
+	if configs.LimitFailurePolicy != "" {
+		rateLimitMiddleware.WithFailurePolicy(usecase.FailurePolicy(configs.LimitFailurePolicy), configs.LimitBreakerThreshold, configs.LimitBreakerCooldown)
+	}
+
+	// As entradas incluídas pela API ficam no Redis, compartilhadas entre as instâncias
+	accessListRepository := limit.NewRedisLimitRepositoryWithClient(redisClient)
+	accessListRepository.KeyPrefix = keyNamespace.Prefix
+
+	// As chaves gravadas antes do namespace passam para ele, os contadores continuam valendo
+	if configs.RedisMigrateKeys {
+		migrated, err := accessListRepository.MigrateLegacyKeys(context.Background(), keyNamespace.LegacyId)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%d chaves legadas migradas para %s\n", migrated, keyNamespace.Prefix)
+	}
+
+	accessList := usecase.NewAccessListUseCase(accessListRepository)
+	if err := accessList.SetStaticEntries(accessEntries(configs)); err != nil {
+		panic(err)
+	}
+
+	rateLimit := limitRules(rateLimitMiddleware.WithAccessList(accessList), configs).BuildMiddleware()
+
+	// Os limites e a política são recarregados sem reiniciar, os contadores continuam no Redis
+	configsPkg.WatchConfig(configs, func(cfg *configsPkg.Config) error {
+		if err := rateLimit.Reload(limitRules(myMiddlewares.NewRateLimitMiddlewareBuilder(), cfg)); err != nil {
+			return err
+		}
+
+		return accessList.SetStaticEntries(accessEntries(cfg))
+	})
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -29,16 +87,151 @@ func main() {
 	r.Route("/rate-limit", func(r chi.Router) {
 		r.Use(jwtauth.Verify(configs.TokenAuth, jwtcustomverifiers.VerifyApiKeyHeader))
 		// r.Use(jwtauth.Authenticator)
-		r.Use(
-			rateLimitMiddleware.
-				WithRateLimitByIP(configs.IpMaxReqsBySec, configs.IpBlockTimeBySec).
-				WithRateLimitByToken().
-				WithRedis(configs.RedisHost, configs.RedisPort).
-				Build())
+		r.Use(rateLimit.ReturnRateLimitHandler())
 		r.Get("/", handlers.NewAnyHandler().GetAny)
 	})
 
 	r.Post("/generate_token", handlers.NewJWTAPIKeyHandler().CreateJWTAPIKey)
 
+	// Sem ADMIN_TOKEN a API de administração não existe
+	if configs.AdminToken != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(myMiddlewares.AdminAuth(configs.AdminToken))
+
+			accessListHandler := handlers.NewAccessListHandler(accessList)
+			r.Get("/access-list", accessListHandler.ListAccessEntries)
+			r.Post("/access-list", accessListHandler.AddAccessEntry)
+			r.Delete("/access-list", accessListHandler.RemoveAccessEntry)
+
+			// As strategies redis_gcra e redis_leased não guardam o estado como um limit
+			if limitAdmin := rateLimit.LimitAdmin(); limitAdmin != nil {
+				limitAdminHandler := handlers.NewLimitAdminHandler(limitAdmin)
+				r.Get("/limits", limitAdminHandler.ListLimits)
+				r.Get("/limit", limitAdminHandler.GetLimit)
+				r.Delete("/limit", limitAdminHandler.ResetLimit)
+				r.Post("/limit/unblock", limitAdminHandler.UnblockLimit)
+				r.Post("/limit/block", limitAdminHandler.BlockLimit)
+			}
+		})
+	}
+
 	http.ListenAndServe(fmt.Sprintf(":%s", configs.WebServerPort), r)
 }
+
+func redisConfig(cfg *configsPkg.Config) limit.RedisConfig {
+	return limit.RedisConfig{
+		Mode:             cfg.RedisMode,
+		URL:              cfg.RedisURL,
+		Host:             cfg.RedisHost,
+		Port:             cfg.RedisPort,
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		SentinelUsername: cfg.RedisSentinelUsername,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		DB:               cfg.RedisDB,
+		TLS:              cfg.RedisTLS,
+		TLSCAFile:        cfg.RedisTLSCAFile,
+		TLSCertFile:      cfg.RedisTLSCertFile,
+		TLSKeyFile:       cfg.RedisTLSKeyFile,
+		TLSServerName:    cfg.RedisTLSServerName,
+		PoolSize:         cfg.RedisPoolSize,
+		MinIdleConns:     cfg.RedisMinIdleConns,
+		DialTimeout:      cfg.RedisDialTimeout,
+		ReadTimeout:      cfg.RedisReadTimeout,
+		WriteTimeout:     cfg.RedisWriteTimeout,
+		Protocol:         cfg.RedisProtocol,
+	}
+}
+
+// limitRules aplica ao builder os limites e a política da configuração, é o que uma recarga troca
+func limitRules(builder *myMiddlewares.RateLimitMiddlewareBuilder, cfg *configsPkg.Config) *myMiddlewares.RateLimitMiddlewareBuilder {
+	return builder.
+		WithRateLimitByIPWindow(cfg.IpMaxReqs, cfg.IpWindow, cfg.IpBlockTimeBySec).
+		WithIPBurst(cfg.IpBurst).
+		WithTrustedProxies(cfg.TrustedProxies, cfg.ClientIPHeaders...).
+		WithIPPrefixes(cfg.IpV4Prefix, cfg.IpV6Prefix).
+		WithRateLimitByToken().
+		WithRouteRules(routeRules(cfg.Policy)...).
+		WithPolicyRules(policyRules(cfg.Policy)...).
+		WithAlgorithm(usecase.LimitAlgorithm(cfg.LimitAlgorithm)).
+		WithBlockPolicy(usecase.BlockPolicy(cfg.LimitBlockPolicy)).
+		WithPenaltyDecay(cfg.LimitPenaltyDecay)
+}
+
+func keyLimits(limits configsPkg.LimitsConf) myMiddlewares.KeyLimits {
+	return myMiddlewares.KeyLimits{
+		MaxReqs:        limits.MaxReqs,
+		Window:         limits.Window,
+		BlockTimeBySec: limits.BlockTimeBySec,
+		Burst:          limits.Burst,
+		Algorithm:      usecase.LimitAlgorithm(limits.Algorithm),
+		BlockPolicy:    usecase.BlockPolicy(limits.BlockPolicy),
+		PenaltyDecay:   limits.PenaltyDecay,
+	}
+}
+
+func routeRules(policy configsPkg.PolicyConf) []myMiddlewares.RouteRule {
+	rules := make([]myMiddlewares.RouteRule, len(policy.Routes))
+	for i, rule := range policy.Routes {
+		rules[i] = myMiddlewares.RouteRule{
+			Method:  rule.Method,
+			Pattern: rule.Pattern,
+			Limits:  keyLimits(rule.LimitsConf),
+		}
+	}
+
+	return rules
+}
+
+func policyRules(policy configsPkg.PolicyConf) []myMiddlewares.PolicyRule {
+	rules := make([]myMiddlewares.PolicyRule, len(policy.Rules))
+	for i, rule := range policy.Rules {
+		rules[i] = myMiddlewares.PolicyRule{
+			Name: rule.Name,
+			Match: myMiddlewares.PolicyMatch{
+				Methods: rule.Match.Methods,
+				Path:    rule.Match.Path,
+				Headers: matchValues(rule.Match.Headers),
+				CIDRs:   rule.Match.CIDRs,
+				Claims:  matchValues(rule.Match.Claims),
+			},
+			Key:    rule.Key,
+			Limits: keyLimits(rule.LimitsConf),
+		}
+	}
+
+	return rules
+}
+
+func matchValues(values []configsPkg.MatchValueConf) map[string]string {
+	matches := make(map[string]string, len(values))
+	for _, value := range values {
+		matches[strings.TrimSpace(value.Name)] = value.Value
+	}
+
+	return matches
+}
+
+// accessEntries junta as listas do ambiente e as do arquivo de política
+func accessEntries(cfg *configsPkg.Config) []limit_entity.AccessEntry {
+	var entries []limit_entity.AccessEntry
+
+	add := func(action string, kind string, values []string) {
+		for _, value := range values {
+			entries = append(entries, limit_entity.AccessEntry{Action: action, Kind: kind, Value: value})
+		}
+	}
+
+	add(limit_entity.AccessAllow, limit_entity.AccessKindCIDR, cfg.AllowCIDRs)
+	add(limit_entity.AccessAllow, limit_entity.AccessKindCIDR, cfg.Policy.Allow.CIDRs)
+	add(limit_entity.AccessAllow, limit_entity.AccessKindSub, cfg.AllowSubs)
+	add(limit_entity.AccessAllow, limit_entity.AccessKindSub, cfg.Policy.Allow.Subs)
+	add(limit_entity.AccessDeny, limit_entity.AccessKindCIDR, cfg.DenyCIDRs)
+	add(limit_entity.AccessDeny, limit_entity.AccessKindCIDR, cfg.Policy.Deny.CIDRs)
+	add(limit_entity.AccessDeny, limit_entity.AccessKindSub, cfg.DenySubs)
+	add(limit_entity.AccessDeny, limit_entity.AccessKindSub, cfg.Policy.Deny.Subs)
+
+	return entries
+}
@@ -2,21 +2,70 @@ package configs
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-chi/jwtauth"
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
 )
 
+// Config é a configuração carregada, exportada para quem recebe as recargas do WatchConfig
+type Config = conf
+
 type conf struct {
-	IpMaxReqsBySec   int32  `mapstructure:"IP_MAX_REQS_BY_SEC" validate:"required"`
-	IpBlockTimeBySec int32  `mapstructure:"IP_BLOCK_TIME_BY_SEC" validate:"required"`
-	WebServerPort    string `mapstructure:"WEB_SERVER_PORT" validate:"required"`
-	RedisHost        string `mapstructure:"REDIS_HOST" validate:"required"`
-	RedisPort        string `mapstructure:"REDIS_PORT" validate:"required"`
-	JWTSecret        string `mapstructure:"JWT_SECRET" validate:"required"`
-	JWTExpiresIn     int    `mapstructure:"JWT_EXPIRES_IN" validate:"required"`
-	TokenAuth        *jwtauth.JWTAuth
+	IpMaxReqsBySec        int32         `mapstructure:"IP_MAX_REQS_BY_SEC" validate:"required_without=IpMaxReqs"`
+	IpMaxReqs             int32         `mapstructure:"IP_MAX_REQS" validate:"required_without=IpMaxReqsBySec"`
+	IpWindow              time.Duration `mapstructure:"IP_WINDOW" validate:"gte=0"`
+	IpBlockTimeBySec      int32         `mapstructure:"IP_BLOCK_TIME_BY_SEC" validate:"required"`
+	IpBurst               int32         `mapstructure:"IP_BURST" validate:"gte=0"`
+	WebServerPort         string        `mapstructure:"WEB_SERVER_PORT" validate:"required"`
+	RedisMode             string        `mapstructure:"REDIS_MODE" validate:"omitempty,oneof=standalone sentinel cluster"`
+	RedisURL              string        `mapstructure:"REDIS_URL" validate:"omitempty,url"`
+	RedisAddrs            []string      `mapstructure:"REDIS_ADDRS" validate:"dive,hostname_port"`
+	RedisMasterName       string        `mapstructure:"REDIS_SENTINEL_MASTER" validate:"required_if=RedisMode sentinel"`
+	RedisSentinelUsername string        `mapstructure:"REDIS_SENTINEL_USERNAME"`
+	RedisSentinelPassword string        `mapstructure:"REDIS_SENTINEL_PASSWORD"`
+	RedisHost             string        `mapstructure:"REDIS_HOST" validate:"required_without_all=RedisURL RedisAddrs"`
+	RedisPort             string        `mapstructure:"REDIS_PORT" validate:"required_without_all=RedisURL RedisAddrs"`
+	RedisUsername         string        `mapstructure:"REDIS_USERNAME"`
+	RedisPassword         string        `mapstructure:"REDIS_PASSWORD"`
+	RedisDB               int           `mapstructure:"REDIS_DB" validate:"gte=0"`
+	RedisTLS              bool          `mapstructure:"REDIS_TLS"`
+	RedisTLSCAFile        string        `mapstructure:"REDIS_TLS_CA_FILE" validate:"omitempty,file"`
+	RedisTLSCertFile      string        `mapstructure:"REDIS_TLS_CERT_FILE" validate:"required_with=RedisTLSKeyFile,omitempty,file"`
+	RedisTLSKeyFile       string        `mapstructure:"REDIS_TLS_KEY_FILE" validate:"required_with=RedisTLSCertFile,omitempty,file"`
+	RedisTLSServerName    string        `mapstructure:"REDIS_TLS_SERVER_NAME"`
+	RedisPoolSize         int           `mapstructure:"REDIS_POOL_SIZE" validate:"gte=0"`
+	RedisMinIdleConns     int           `mapstructure:"REDIS_MIN_IDLE_CONNS" validate:"gte=0"`
+	RedisDialTimeout      time.Duration `mapstructure:"REDIS_DIAL_TIMEOUT" validate:"gte=0"`
+	RedisReadTimeout      time.Duration `mapstructure:"REDIS_READ_TIMEOUT" validate:"gte=-1"`
+	RedisWriteTimeout     time.Duration `mapstructure:"REDIS_WRITE_TIMEOUT" validate:"gte=-1"`
+	RedisProtocol         int           `mapstructure:"REDIS_PROTOCOL" validate:"omitempty,oneof=2 3"`
+	RedisKeyPrefix        string        `mapstructure:"REDIS_KEY_PREFIX" validate:"excludesall={}"`
+	RedisKeyHashTag       bool          `mapstructure:"REDIS_KEY_HASH_TAG"`
+	RedisMigrateKeys      bool          `mapstructure:"REDIS_MIGRATE_LEGACY_KEYS" validate:"excluded_without=RedisKeyPrefix"`
+	JWTSecret             string        `mapstructure:"JWT_SECRET" validate:"required"`
+	JWTExpiresIn          int           `mapstructure:"JWT_EXPIRES_IN" validate:"required"`
+	LimitAlgorithm        string        `mapstructure:"LIMIT_ALGORITHM" validate:"omitempty,oneof=fixed_window sliding_window_log token_bucket sliding_window_counter"`
+	LimitBlockPolicy      string        `mapstructure:"LIMIT_BLOCK_POLICY" validate:"omitempty,oneof=extend fixed exponential"`
+	LimitPenaltyDecay     time.Duration `mapstructure:"LIMIT_PENALTY_DECAY" validate:"gte=0"`
+	LimitStrategy         string        `mapstructure:"LIMIT_STRATEGY" validate:"omitempty,oneof=redis redis_approximate redis_gcra redis_leased"`
+	LimitFailurePolicy    string        `mapstructure:"LIMIT_FAILURE_POLICY" validate:"omitempty,oneof=closed open fallback"`
+	LimitBreakerThreshold int           `mapstructure:"LIMIT_BREAKER_THRESHOLD" validate:"gte=0"`
+	LimitBreakerCooldown  time.Duration `mapstructure:"LIMIT_BREAKER_COOLDOWN" validate:"gte=0"`
+	LimitLeaseFraction    float64       `mapstructure:"LIMIT_LEASE_FRACTION" validate:"gte=0,lte=1"`
+	TrustedProxies        []string      `mapstructure:"TRUSTED_PROXIES" validate:"dive,cidr|ip"`
+	ClientIPHeaders       []string      `mapstructure:"CLIENT_IP_HEADERS" validate:"dive,oneof=Forwarded X-Forwarded-For X-Real-IP"`
+	IpV4Prefix            int           `mapstructure:"IP_V4_PREFIX" validate:"gte=0,lte=32"`
+	IpV6Prefix            int           `mapstructure:"IP_V6_PREFIX" validate:"gte=0,lte=128"`
+	PolicyFile            string        `mapstructure:"LIMIT_POLICY_FILE"`
+	AllowCIDRs            []string      `mapstructure:"ALLOW_CIDRS" validate:"dive,cidr|ip"`
+	DenyCIDRs             []string      `mapstructure:"DENY_CIDRS" validate:"dive,cidr|ip"`
+	AllowSubs             []string      `mapstructure:"ALLOW_SUBS" validate:"dive,required"`
+	DenySubs              []string      `mapstructure:"DENY_SUBS" validate:"dive,required"`
+	AdminToken            string        `mapstructure:"ADMIN_TOKEN"`
+	Policy                PolicyConf    `mapstructure:"-"`
+	TokenAuth             *jwtauth.JWTAuth
 }
 
 func LoadConfig(path string) (*conf, error) {
@@ -32,17 +81,66 @@ func LoadConfig(path string) (*conf, error) {
 	// bind ENV VARS explicitamente
 	keys := []string{
 		"IP_MAX_REQS_BY_SEC",
+		"IP_MAX_REQS",
+		"IP_WINDOW",
 		"IP_BLOCK_TIME_BY_SEC",
+		"IP_BURST",
 		"WEB_SERVER_PORT",
 		"REDIS_HOST",
 		"REDIS_PORT",
+		"REDIS_MODE",
+		"REDIS_URL",
+		"REDIS_ADDRS",
+		"REDIS_SENTINEL_MASTER",
+		"REDIS_SENTINEL_USERNAME",
+		"REDIS_SENTINEL_PASSWORD",
+		"REDIS_USERNAME",
+		"REDIS_PASSWORD",
+		"REDIS_DB",
+		"REDIS_TLS",
+		"REDIS_TLS_CA_FILE",
+		"REDIS_TLS_CERT_FILE",
+		"REDIS_TLS_KEY_FILE",
+		"REDIS_TLS_SERVER_NAME",
+		"REDIS_POOL_SIZE",
+		"REDIS_MIN_IDLE_CONNS",
+		"REDIS_DIAL_TIMEOUT",
+		"REDIS_READ_TIMEOUT",
+		"REDIS_WRITE_TIMEOUT",
+		"REDIS_PROTOCOL",
+		"REDIS_KEY_PREFIX",
+		"REDIS_KEY_HASH_TAG",
+		"REDIS_MIGRATE_LEGACY_KEYS",
 		"JWT_SECRET",
 		"JWT_EXPIRES_IN",
+		"LIMIT_ALGORITHM",
+		"LIMIT_BLOCK_POLICY",
+		"LIMIT_PENALTY_DECAY",
+		"LIMIT_STRATEGY",
+		"LIMIT_LEASE_FRACTION",
+		"LIMIT_FAILURE_POLICY",
+		"LIMIT_BREAKER_THRESHOLD",
+		"LIMIT_BREAKER_COOLDOWN",
+		"TRUSTED_PROXIES",
+		"CLIENT_IP_HEADERS",
+		"IP_V4_PREFIX",
+		"IP_V6_PREFIX",
+		"LIMIT_POLICY_FILE",
+		"ALLOW_CIDRS",
+		"DENY_CIDRS",
+		"ALLOW_SUBS",
+		"DENY_SUBS",
+		"ADMIN_TOKEN",
 	}
 	for _, key := range keys {
 		viper.BindEnv(key)
 	}
 
+	// Os mesmos padrões do middleware. Como default do viper, um prefixo 0 explícito vale:
+	// todos os endereços da família numa chave só
+	viper.SetDefault("IP_V4_PREFIX", 32)
+	viper.SetDefault("IP_V6_PREFIX", 64)
+
 	// Try load .env
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -56,12 +154,79 @@ func LoadConfig(path string) (*conf, error) {
 		return nil, err
 	}
 
-	validate := validator.New(validator.WithRequiredStructEnabled())
-	if err := validate.Struct(&cfg); err != nil {
+	if err := completeConfig(&cfg); err != nil {
 		return nil, err
 	}
 
+	return &cfg, nil
+}
+
+// completeConfig carrega o arquivo de política, valida e preenche os valores padrão
+func completeConfig(cfg *conf) error {
+	if cfg.PolicyFile != "" {
+		policy, err := LoadPolicy(cfg.PolicyFile)
+		if err != nil {
+			return err
+		}
+		cfg.Policy = *policy
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(cfg); err != nil {
+		return err
+	}
+
+	if err := validateLeasedAlgorithms(cfg); err != nil {
+		return err
+	}
+
+	// IP_MAX_REQS_BY_SEC é o formato antigo, equivale a IP_MAX_REQS com IP_WINDOW de 1s
+	if cfg.IpMaxReqs == 0 {
+		cfg.IpMaxReqs = cfg.IpMaxReqsBySec
+		cfg.IpWindow = time.Second
+	}
+
+	if cfg.IpWindow == 0 {
+		cfg.IpWindow = time.Second
+	}
+
+	// No Cluster as chaves de um limite só ficam no mesmo slot com a hash tag
+	if cfg.RedisMode == "cluster" {
+		cfg.RedisKeyHashTag = true
+	}
+
 	cfg.TokenAuth = jwtauth.New("HS256", []byte(cfg.JWTSecret), nil)
 
-	return &cfg, nil
+	return nil
+}
+
+// validateLeasedAlgorithms recusa na subida e na recarga o que o redis_leased negaria em toda
+// requisição: ele só empresta cotas de janela fixa
+func validateLeasedAlgorithms(cfg *conf) error {
+	if cfg.LimitStrategy != "redis_leased" {
+		return nil
+	}
+
+	if !isFixedWindow(cfg.LimitAlgorithm) {
+		return fmt.Errorf("LIMIT_STRATEGY redis_leased only supports the fixed_window algorithm, got %s", cfg.LimitAlgorithm)
+	}
+
+	for _, route := range cfg.Policy.Routes {
+		if !isFixedWindow(route.Algorithm) {
+			return fmt.Errorf("LIMIT_STRATEGY redis_leased only supports the fixed_window algorithm, route %s %s uses %s", route.Method, route.Pattern, route.Algorithm)
+		}
+	}
+
+	for _, rule := range cfg.Policy.Rules {
+		if !isFixedWindow(rule.Algorithm) {
+			return fmt.Errorf("LIMIT_STRATEGY redis_leased only supports the fixed_window algorithm, rule %s uses %s", rule.Name, rule.Algorithm)
+		}
+	}
+
+	return nil
+}
+
+// isFixedWindow considera vazio como fixed_window, o padrão dos Limiters
+func isFixedWindow(algorithm string) bool {
+	return algorithm == "" || algorithm == "fixed_window"
 }
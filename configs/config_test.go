@@ -0,0 +1,119 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConf() conf {
+	return conf{
+		IpMaxReqs:        10,
+		IpBlockTimeBySec: 5,
+		WebServerPort:    "8080",
+		RedisHost:        "localhost",
+		RedisPort:        "6379",
+		JWTSecret:        "secret",
+		JWTExpiresIn:     300,
+	}
+}
+
+func TestCompleteConfig_LeasedStrategyAlgorithm(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		algorithm string
+		policy    string
+		wantErr   bool
+	}{
+		{name: "leased with the default algorithm", strategy: "redis_leased"},
+		{name: "leased with fixed_window", strategy: "redis_leased", algorithm: "fixed_window"},
+		{name: "leased with token_bucket", strategy: "redis_leased", algorithm: "token_bucket", wantErr: true},
+		{name: "leased with sliding_window_log", strategy: "redis_leased", algorithm: "sliding_window_log", wantErr: true},
+		{name: "other strategies take any algorithm", strategy: "redis_gcra", algorithm: "token_bucket"},
+		{
+			name:     "leased with a fixed_window rule",
+			strategy: "redis_leased",
+			policy:   "rules:\n  - name: free\n    key: ip\n    max_reqs: 2\n    algorithm: fixed_window\n",
+		},
+		{
+			name:     "leased with a sliding_window_counter rule",
+			strategy: "redis_leased",
+			policy:   "rules:\n  - name: free\n    key: ip\n    max_reqs: 2\n    algorithm: sliding_window_counter\n",
+			wantErr:  true,
+		},
+		{
+			name:     "leased with a token_bucket route",
+			strategy: "redis_leased",
+			policy:   "routes:\n  - pattern: /orders\n    max_reqs: 2\n    algorithm: token_bucket\n",
+			wantErr:  true,
+		},
+		{
+			name:     "approximate with a token_bucket rule",
+			strategy: "redis_approximate",
+			policy:   "rules:\n  - name: free\n    key: ip\n    max_reqs: 2\n    algorithm: token_bucket\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConf()
+			cfg.LimitStrategy = tt.strategy
+			cfg.LimitAlgorithm = tt.algorithm
+
+			if tt.policy != "" {
+				cfg.PolicyFile = filepath.Join(t.TempDir(), "policy.yaml")
+				require.NoError(t, os.WriteFile(cfg.PolicyFile, []byte(tt.policy), 0o600))
+			}
+
+			err := completeConfig(&cfg)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "redis_leased only supports the fixed_window algorithm")
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLoadConfig_IPPrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		v4Prefix int
+		v6Prefix int
+	}{
+		{name: "defaults", v4Prefix: 32, v6Prefix: 64},
+		{name: "explicit prefixes", env: map[string]string{"IP_V4_PREFIX": "24", "IP_V6_PREFIX": "48"}, v4Prefix: 24, v6Prefix: 48},
+		{name: "explicit zero is kept", env: map[string]string{"IP_V4_PREFIX": "0", "IP_V6_PREFIX": "0"}, v4Prefix: 0, v6Prefix: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("IP_MAX_REQS", "10")
+			t.Setenv("IP_BLOCK_TIME_BY_SEC", "5")
+			t.Setenv("WEB_SERVER_PORT", "8080")
+			t.Setenv("REDIS_HOST", "localhost")
+			t.Setenv("REDIS_PORT", "6379")
+			t.Setenv("JWT_SECRET", "secret")
+			t.Setenv("JWT_EXPIRES_IN", "300")
+			t.Setenv("IP_V4_PREFIX", "")
+			t.Setenv("IP_V6_PREFIX", "")
+			os.Unsetenv("IP_V4_PREFIX")
+			os.Unsetenv("IP_V6_PREFIX")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := LoadConfig(t.TempDir())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.v4Prefix, cfg.IpV4Prefix)
+			assert.Equal(t, tt.v6Prefix, cfg.IpV6Prefix)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package configs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+)
+
+// PolicyConf é o arquivo LIMIT_POLICY_FILE, YAML ou JSON. routes troca os limites por rota
+// mantendo a chave padrão; rules são avaliadas em ordem antes dela, a primeira que casar vence:
+//
+//	routes:
+//	  - method: POST
+//	    pattern: /rate-limit/orders
+//	    max_reqs: 2
+//	    window: 1s
+//	    block_time_by_sec: 5
+//	rules:
+//	  - name: free-plan
+//	    match:
+//	      path: /rate-limit/*
+//	      claims:
+//	        - name: plan
+//	          value: free
+//	    key: token
+//	    max_reqs: 10
+//	    window: 1m
+//	    block_time_by_sec: 60
+//	allow:
+//	  cidrs:
+//	    - 10.0.0.0/8
+//	deny:
+//	  subs:
+//	    - 6f1c0a7e-revoked
+type PolicyConf struct {
+	Routes []RouteRuleConf  `mapstructure:"routes" validate:"dive"`
+	Rules  []PolicyRuleConf `mapstructure:"rules" validate:"unique=Name,dive"`
+	Allow  AccessListConf   `mapstructure:"allow"`
+	Deny   AccessListConf   `mapstructure:"deny"`
+}
+
+// AccessListConf soma às listas ALLOW_* e DENY_* do ambiente. subs é o sub do JWT.
+type AccessListConf struct {
+	CIDRs []string `mapstructure:"cidrs" validate:"dive,cidr|ip"`
+	Subs  []string `mapstructure:"subs" validate:"dive,required"`
+}
+
+// LimitsConf são os limites comuns às regras, sem window vale 1s
+type LimitsConf struct {
+	MaxReqs        int32         `mapstructure:"max_reqs" validate:"required,gt=0"`
+	Window         time.Duration `mapstructure:"window" validate:"gte=0"`
+	BlockTimeBySec int32         `mapstructure:"block_time_by_sec" validate:"gte=0"`
+	Burst          int32         `mapstructure:"burst" validate:"gte=0"`
+	Algorithm      string        `mapstructure:"algorithm" validate:"omitempty,oneof=fixed_window sliding_window_log token_bucket sliding_window_counter"`
+	BlockPolicy    string        `mapstructure:"block_policy" validate:"omitempty,oneof=extend fixed exponential"`
+	PenaltyDecay   time.Duration `mapstructure:"penalty_decay" validate:"gte=0"`
+}
+
+type RouteRuleConf struct {
+	Method     string `mapstructure:"method" validate:"omitempty,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS CONNECT TRACE"`
+	Pattern    string `mapstructure:"pattern" validate:"required,startswith=/"`
+	LimitsConf `mapstructure:",squash"`
+}
+
+// PolicyRuleConf tem key ip, token (sub do JWT), global, header:<nome> ou claim:<nome>
+type PolicyRuleConf struct {
+	Name       string          `mapstructure:"name" validate:"required"`
+	Match      PolicyMatchConf `mapstructure:"match"`
+	Key        string          `mapstructure:"key" validate:"required,oneof=ip token global|startswith=header:|startswith=claim:"`
+	LimitsConf `mapstructure:",squash"`
+}
+
+// PolicyMatchConf são os critérios da regra, todos precisam casar. Headers e claims são
+// listas de nome e valor porque o viper deixa as chaves de mapas em minúsculas.
+type PolicyMatchConf struct {
+	Methods []string         `mapstructure:"methods" validate:"dive,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS CONNECT TRACE"`
+	Path    string           `mapstructure:"path" validate:"omitempty,startswith=/"`
+	Headers []MatchValueConf `mapstructure:"headers" validate:"dive"`
+	CIDRs   []string         `mapstructure:"cidrs" validate:"dive,cidr|ip"`
+	Claims  []MatchValueConf `mapstructure:"claims" validate:"dive"`
+}
+
+// MatchValueConf sem value só exige que o header ou a claim exista
+type MatchValueConf struct {
+	Name  string `mapstructure:"name" validate:"required"`
+	Value string `mapstructure:"value"`
+}
+
+// LoadPolicy lê o arquivo com uma instância própria do viper, o formato vem da extensão.
+// Campos desconhecidos são erro para que um erro de digitação não passe despercebido.
+func LoadPolicy(path string) (*PolicyConf, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var policy PolicyConf
+	if err := v.UnmarshalExact(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	for i := range policy.Routes {
+		policy.Routes[i].Method = strings.ToUpper(policy.Routes[i].Method)
+		policy.Routes[i].LimitsConf = policy.Routes[i].LimitsConf.withDefaults()
+	}
+
+	for i := range policy.Rules {
+		for j, method := range policy.Rules[i].Match.Methods {
+			policy.Rules[i].Match.Methods[j] = strings.ToUpper(method)
+		}
+		policy.Rules[i].LimitsConf = policy.Rules[i].LimitsConf.withDefaults()
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	return &policy, nil
+}
+
+func (l LimitsConf) withDefaults() LimitsConf {
+	if l.Window == 0 {
+		l.Window = time.Second
+	}
+
+	return l
+}
@@ -0,0 +1,254 @@
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// restartFields só são lidos na subida do servidor. Numa recarga eles mantêm o valor em uso
+// e a mudança só é avisada.
+var restartFields = []string{
+	"WebServerPort",
+	"RedisHost",
+	"RedisPort",
+	"JWTSecret",
+	"JWTExpiresIn",
+	"LimitStrategy",
+	"LimitLeaseFraction",
+	"PolicyFile",
+	"AdminToken",
+}
+
+// secretFields aparecem no diff sem o valor
+var secretFields = map[string]bool{
+	"JWTSecret":  true,
+	"AdminToken": true,
+}
+
+// reloadDelay espera os editores terminarem de gravar, eles costumam truncar o arquivo
+// antes de escrever e o arquivo vazio seria uma política válida sem nenhuma regra
+const reloadDelay = 200 * time.Millisecond
+
+type configWatcher struct {
+	current  *conf
+	onChange func(*conf) error
+	warned   map[string]interface{}
+	mutex    sync.Mutex
+	timer    *time.Timer
+	timerMu  sync.Mutex
+}
+
+// WatchConfig recarrega o .env e o arquivo de política quando mudam. A configuração nova é
+// validada e entregue a onChange; se for inválida, ou onChange devolver erro, a recarga é
+// rejeitada e a configuração em uso continua valendo.
+func WatchConfig(current *conf, onChange func(*conf) error) {
+	watcher := &configWatcher{
+		current:  current,
+		onChange: onChange,
+		warned:   make(map[string]interface{}),
+	}
+
+	if viper.ConfigFileUsed() != "" {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			watcher.schedule(e.Name)
+		})
+		viper.WatchConfig()
+	}
+
+	if current.PolicyFile != "" {
+		policyViper := viper.New()
+		policyViper.SetConfigFile(current.PolicyFile)
+		policyViper.OnConfigChange(func(e fsnotify.Event) {
+			watcher.schedule(e.Name)
+		})
+		policyViper.WatchConfig()
+	}
+}
+
+// schedule junta os eventos de uma mesma gravação em uma recarga só
+func (w *configWatcher) schedule(file string) {
+	w.timerMu.Lock()
+	defer w.timerMu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	w.timer = time.AfterFunc(reloadDelay, func() {
+		w.reload(file)
+	})
+}
+
+// reload roda nas goroutines dos timers, o mutex serializa as recargas
+func (w *configWatcher) reload(file string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var cfg conf
+	if err := viper.Unmarshal(&cfg); err != nil {
+		fmt.Printf("Recarga de %s rejeitada: %s\n", file, err)
+		return
+	}
+
+	for field, value := range keepRestartFields(w.current, &cfg) {
+		if !reflect.DeepEqual(w.warned[field], value) {
+			fmt.Printf("%s mudou em %s, só vale depois de reiniciar o servidor\n", field, file)
+			w.warned[field] = value
+		}
+	}
+
+	if err := completeConfig(&cfg); err != nil {
+		fmt.Printf("Recarga de %s rejeitada: %s\n", file, err)
+		return
+	}
+
+	changes := Diff(w.current, &cfg)
+	if len(changes) == 0 {
+		return
+	}
+
+	if err := w.onChange(&cfg); err != nil {
+		fmt.Printf("Recarga de %s rejeitada: %s\n", file, err)
+		return
+	}
+
+	w.current = &cfg
+
+	fmt.Printf("Configuração recarregada de %s:\n", file)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+}
+
+// keepRestartFields copia para cfg os restartFields em uso e devolve as variáveis que mudaram
+// com o valor novo
+func keepRestartFields(current *conf, cfg *conf) map[string]interface{} {
+	changed := make(map[string]interface{})
+
+	currentValue := reflect.ValueOf(current).Elem()
+	cfgValue := reflect.ValueOf(cfg).Elem()
+	cfgType := cfgValue.Type()
+
+	for _, name := range restartFields {
+		field, _ := cfgType.FieldByName(name)
+		if !reflect.DeepEqual(currentValue.FieldByName(name).Interface(), cfgValue.FieldByName(name).Interface()) {
+			changed[field.Tag.Get("mapstructure")] = cfgValue.FieldByName(name).Interface()
+		}
+
+		cfgValue.FieldByName(name).Set(currentValue.FieldByName(name))
+	}
+
+	return changed
+}
+
+// Diff lista o que mudou entre duas configurações, uma linha por variável ou regra da política
+func Diff(old *conf, new *conf) []string {
+	var changes []string
+
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	confType := oldValue.Type()
+
+	for i := 0; i < confType.NumField(); i++ {
+		field := confType.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		before, after := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		if secretFields[field.Name] {
+			changes = append(changes, fmt.Sprintf("%s: alterado", name))
+			continue
+		}
+
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, before, after))
+	}
+
+	oldRouteNames, oldRoutes := routesByName(old.Policy.Routes)
+	newRouteNames, newRoutes := routesByName(new.Policy.Routes)
+	changes = append(changes, diffRules("route", oldRouteNames, oldRoutes, newRouteNames, newRoutes)...)
+
+	oldRuleNames, oldRules := rulesByName(old.Policy.Rules)
+	newRuleNames, newRules := rulesByName(new.Policy.Rules)
+	changes = append(changes, diffRules("rule", oldRuleNames, oldRules, newRuleNames, newRules)...)
+
+	// A primeira rule que casar vence, então só trocar a ordem também muda a política
+	if len(changes) == 0 && !reflect.DeepEqual(oldRuleNames, newRuleNames) {
+		changes = append(changes, fmt.Sprintf("~ rules order: %v -> %v", oldRuleNames, newRuleNames))
+	}
+
+	if !reflect.DeepEqual(old.Policy.Allow, new.Policy.Allow) {
+		changes = append(changes, fmt.Sprintf("~ allow: %+v -> %+v", old.Policy.Allow, new.Policy.Allow))
+	}
+
+	if !reflect.DeepEqual(old.Policy.Deny, new.Policy.Deny) {
+		changes = append(changes, fmt.Sprintf("~ deny: %+v -> %+v", old.Policy.Deny, new.Policy.Deny))
+	}
+
+	return changes
+}
+
+func routesByName(routes []RouteRuleConf) ([]string, map[string]interface{}) {
+	names := make([]string, 0, len(routes))
+	byName := make(map[string]interface{}, len(routes))
+
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = "*"
+		}
+
+		name := method + " " + route.Pattern
+		names = append(names, name)
+		byName[name] = route
+	}
+
+	return names, byName
+}
+
+func rulesByName(rules []PolicyRuleConf) ([]string, map[string]interface{}) {
+	names := make([]string, 0, len(rules))
+	byName := make(map[string]interface{}, len(rules))
+
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+		byName[rule.Name] = rule
+	}
+
+	return names, byName
+}
+
+// diffRules compara as regras pelo nome
+func diffRules(kind string, oldNames []string, oldRules map[string]interface{}, newNames []string, newRules map[string]interface{}) []string {
+	var changes []string
+
+	for _, name := range oldNames {
+		if _, ok := newRules[name]; !ok {
+			changes = append(changes, fmt.Sprintf("- %s %s", kind, name))
+		}
+	}
+
+	for _, name := range newNames {
+		before, ok := oldRules[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ %s %s: %+v", kind, name, newRules[name]))
+			continue
+		}
+
+		if !reflect.DeepEqual(before, newRules[name]) {
+			changes = append(changes, fmt.Sprintf("~ %s %s: %+v -> %+v", kind, name, before, newRules[name]))
+		}
+	}
+
+	return changes
+}
@@ -6,14 +6,224 @@ import (
 )
 
 type Limit struct {
-	Id      string
-	FreeAt  *time.Time
-	LastAt  time.Time
-	Counter int32
+	Id          string
+	FreeAt      *time.Time
+	LastAt      time.Time
+	Counter     int32
+	Timestamps  []time.Time
+	Tokens      float64
+	WindowStart time.Time
+	PrevCounter int32
+	// Offenses é o nível da penalidade progressiva, que vale até OffenseAt mais o decay.
+	// Sobrevive ao fim do bloqueio, diferente do resto do estado.
+	Offenses  int32
+	OffenseAt time.Time
+	// ExpiresAt é quando o estado deixa de influenciar qualquer decisão e pode ser apagado
+	// pelo repositório, zero nunca expira
+	ExpiresAt time.Time
+}
+
+func (l *Limit) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+// Clone devolve uma cópia que não compartilha ponteiros nem slices com o original
+func (l *Limit) Clone() *Limit {
+	clone := *l
+
+	if l.FreeAt != nil {
+		freeAt := *l.FreeAt
+		clone.FreeAt = &freeAt
+	}
+
+	if l.Timestamps != nil {
+		clone.Timestamps = append([]time.Time(nil), l.Timestamps...)
+	}
+
+	return &clone
 }
 
 type LimitEntityRepository interface {
 	CreateLimit(ctx context.Context, limit *Limit) error
 	GetLimitById(ctx context.Context, id string) (*Limit, error)
 	UpdateLimitById(ctx context.Context, id string, limit *Limit) error
+	// DeleteLimitById apaga o limit, não existir não é erro
+	DeleteLimitById(ctx context.Context, id string) error
+	// ListLimitIds percorre os ids aos poucos, como o SCAN do Redis: começa com cursor zero e
+	// termina quando o cursor devolvido é zero. count é só uma sugestão do tamanho da página.
+	ListLimitIds(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error)
+}
+
+// GCRARule é um limite GCRA sobre uma chave, várias regras são avaliadas juntas
+type GCRARule struct {
+	Key              string
+	EmissionInterval time.Duration
+	BurstTolerance   time.Duration
+	BlockTime        time.Duration
+	BlockPolicy      string
+	MaxBlockTime     time.Duration
+	PenaltyDecay     time.Duration
+}
+
+// GCRADecision é o resultado de uma avaliação GCRA, o estado fica todo no repositório.
+// DeniedRule é o índice da regra que negou, só faz sentido quando Allowed é falso.
+// Remaining e Reset são da LimitingRule: a que negou ou a com menos requisições restantes.
+type GCRADecision struct {
+	Allowed      bool
+	RetryAfter   time.Duration
+	Remaining    int32
+	Reset        time.Duration
+	DeniedRule   int
+	LimitingRule int
+	OffenseLevel int32 // Da regra que negou ou da LimitingRule
+}
+
+type GCRALimitRepository interface {
+	AllowGCRA(ctx context.Context, rules []GCRARule) (*GCRADecision, error)
+}
+
+// AtomicLimitRule é um limite avaliado por inteiro dentro do repositório,
+// sem cache local, para que várias instâncias compartilhem o mesmo contador
+type AtomicLimitRule struct {
+	Key       string
+	Algorithm string
+	MaxReqs   int32
+	Window    time.Duration
+	Burst     int32
+	BlockTime time.Duration
+	// BlockPolicy e MaxBlockTime são usados em BlockedUntil
+	BlockPolicy  string
+	MaxBlockTime time.Duration
+	PenaltyDecay time.Duration
+}
+
+// AtomicLimitDecision é o resultado da avaliação atômica das regras.
+// DeniedRule é o índice da regra que negou, só faz sentido quando Allowed é falso.
+// Limit, Remaining e Reset são da regra que negou ou da com menos requisições restantes.
+type AtomicLimitDecision struct {
+	Allowed      bool
+	RetryAfter   time.Duration
+	DeniedRule   int
+	Limit        int32
+	Remaining    int32
+	Reset        time.Duration
+	OffenseLevel int32
+}
+
+type AtomicLimitRepository interface {
+	EvaluateLimit(ctx context.Context, rules []AtomicLimitRule) (*AtomicLimitDecision, error)
+}
+
+// QuotaLeaseRule pede ao repositório uma fatia do limite de uma chave na janela atual.
+// A fatia é gasta localmente pela instância, sem ida ao repositório a cada requisição.
+type QuotaLeaseRule struct {
+	Key          string
+	MaxReqs      int32
+	Window       time.Duration
+	LeaseSize    int32
+	BlockTime    time.Duration
+	MaxBlockTime time.Duration
+	PenaltyDecay time.Duration
+}
+
+// QuotaLease é a fatia concedida, válida até WindowEnd. Granted zero significa que a
+// janela esgotou; com FreeAt preenchido a chave está bloqueada até lá.
+// Available é o que ainda restava no repositório depois da concessão.
+type QuotaLease struct {
+	Granted      int32
+	Available    int32
+	WindowStart  time.Time
+	WindowEnd    time.Time
+	FreeAt       *time.Time
+	OffenseLevel int32
+}
+
+type QuotaLeaseRepository interface {
+	AcquireQuota(ctx context.Context, rule QuotaLeaseRule) (*QuotaLease, error)
+	// ReleaseQuota devolve o que sobrou de uma fatia, só vale se a janela ainda for a mesma
+	ReleaseQuota(ctx context.Context, key string, windowStart time.Time, unused int32) error
+}
+
+// Ações e tipos das entradas das listas de acesso
+const (
+	AccessAllow    = "allow"
+	AccessDeny     = "deny"
+	AccessKindCIDR = "cidr"
+	AccessKindSub  = "sub"
+)
+
+// AccessEntry é uma entrada das listas de acesso: allow pula o limite e deny recusa a
+// requisição. Kind diz se Value é um CIDR (ou IP solto) ou o sub de um JWT.
+type AccessEntry struct {
+	Action string
+	Kind   string
+	Value  string
+}
+
+// AccessListRepository guarda as entradas incluídas em tempo de execução, compartilhadas
+// entre as instâncias
+type AccessListRepository interface {
+	ListAccessEntries(ctx context.Context) ([]AccessEntry, error)
+	AddAccessEntry(ctx context.Context, entry AccessEntry) error
+	RemoveAccessEntry(ctx context.Context, entry AccessEntry) error
+}
+
+// BlockedUntil aplica a política de extensão a um bloqueio que vai até freeAt e recebeu mais
+// uma requisição, attempts conta as requisições bloqueadas junto com a que bloqueou.
+// fixed não mexe no bloqueio, exponential dobra block a cada tentativa até maxBlock e
+// qualquer outra reinicia o bloqueio. Nenhuma delas encurta um bloqueio mais longo.
+func BlockedUntil(policy string, freeAt time.Time, now time.Time, block time.Duration, maxBlock time.Duration, attempts int32) time.Time {
+	switch policy {
+	case "fixed":
+		return freeAt
+	case "exponential":
+		for i := int32(1); i < attempts && block < maxBlock; i++ {
+			block *= 2
+		}
+		block = min(block, maxBlock)
+	}
+
+	if blockedUntil := now.Add(block); blockedUntil.After(freeAt) {
+		return blockedUntil
+	}
+
+	return freeAt
+}
+
+// Multiplicadores do bloqueio por nível de penalidade, com 5s de bloqueio ficam 5s, 30s, 5m e 1h.
+// Dali em diante o nível continua subindo mas o bloqueio fica no último.
+var PenaltyMultipliers = []int64{1, 6, 60, 720}
+
+// NextOffense conta mais uma infração, que recomeça do nível um se a anterior já decaiu.
+// Sem decay não há penalidade progressiva e o nível fica em zero.
+func NextOffense(offenses int32, offenseAt time.Time, now time.Time, decay time.Duration) int32 {
+	if decay <= 0 {
+		return 0
+	}
+
+	return OffenseLevel(offenses, offenseAt, now, decay) + 1
+}
+
+// OffenseLevel é o nível ainda em vigor, zero depois de decay sem nova infração a contar de
+// offenseAt, o fim previsto do último bloqueio
+func OffenseLevel(offenses int32, offenseAt time.Time, now time.Time, decay time.Duration) int32 {
+	if decay <= 0 || offenses <= 0 || now.Sub(offenseAt) > decay {
+		return 0
+	}
+
+	return offenses
+}
+
+// PenaltyBlockTime é o bloqueio do nível, até maxBlock. Nunca fica menor que block.
+func PenaltyBlockTime(block time.Duration, offenses int32, maxBlock time.Duration) time.Duration {
+	if offenses <= 1 {
+		return block
+	}
+
+	multiplier := PenaltyMultipliers[min(int(offenses), len(PenaltyMultipliers))-1]
+	if block > maxBlock/time.Duration(multiplier) {
+		return max(block, maxBlock)
+	}
+
+	return block * time.Duration(multiplier)
 }
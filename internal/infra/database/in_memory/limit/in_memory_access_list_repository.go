@@ -0,0 +1,47 @@
+package limit
+
+import (
+	"context"
+	"sort"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+func (imdb *InMemoryLimitRepository) ListAccessEntries(ctx context.Context) ([]limit_entity.AccessEntry, error) {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	entries := make([]limit_entity.AccessEntry, 0, len(imdb.AccessEntries))
+	for entry := range imdb.AccessEntries {
+		entries = append(entries, entry)
+	}
+
+	// A ordem do map muda a cada leitura
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Action != entries[j].Action {
+			return entries[i].Action < entries[j].Action
+		}
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Value < entries[j].Value
+	})
+
+	return entries, nil
+}
+
+func (imdb *InMemoryLimitRepository) AddAccessEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	imdb.AccessEntries[entry] = struct{}{}
+	return nil
+}
+
+func (imdb *InMemoryLimitRepository) RemoveAccessEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	delete(imdb.AccessEntries, entry)
+	return nil
+}
@@ -0,0 +1,173 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// Mesma lógica do script Lua do RedisGCRALimitRepository, guardando o TAT por chave e os
+// bloqueios, que continuam ali depois de vencidos por causa da penalidade progressiva.
+// TATs no passado e bloqueios sem penalidade em vigor não mudam nenhuma decisão e são
+// varridos nas chamadas, no máximo a cada SweepInterval.
+type InMemoryGCRALimitRepository struct {
+	Db            map[string]time.Time
+	Blocks        map[string]*gcraBlock
+	Mutex         *sync.Mutex
+	SweepInterval time.Duration
+	lastSweep     time.Time
+}
+
+// gcraBlock é o último bloqueio da chave, quantas requisições ele já recebeu e o nível de
+// penalidade com que foi aplicado
+type gcraBlock struct {
+	FreeAt    time.Time
+	Attempts  int32
+	Offenses  int32
+	OffenseAt time.Time
+	ExpiresAt time.Time
+}
+
+func NewInMemoryGCRALimitRepository() *InMemoryGCRALimitRepository {
+	return &InMemoryGCRALimitRepository{
+		Db:            make(map[string]time.Time),
+		Blocks:        make(map[string]*gcraBlock),
+		Mutex:         &sync.Mutex{},
+		SweepInterval: SWEEP_INTERVAL,
+	}
+}
+
+// sweepIfDue apaga os TATs e bloqueios expirados se já deu o intervalo, precisa do Mutex travado
+func (imdb *InMemoryGCRALimitRepository) sweepIfDue(now time.Time) {
+	if !sweepDue(&imdb.lastSweep, imdb.SweepInterval, now) {
+		return
+	}
+
+	for key, tat := range imdb.Db {
+		if tat.Before(now) {
+			delete(imdb.Db, key)
+		}
+	}
+
+	for key, block := range imdb.Blocks {
+		if block.ExpiresAt.Before(now) {
+			delete(imdb.Blocks, key)
+		}
+	}
+}
+
+func (imdb *InMemoryGCRALimitRepository) AllowGCRA(ctx context.Context, rules []limit_entity.GCRARule) (*limit_entity.GCRADecision, error) {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	now := time.Now()
+	imdb.sweepIfDue(now)
+
+	newTats := make([]time.Time, len(rules))
+	remaining := int32(-1)
+	var reset time.Duration
+	limitingRule := 0
+	var offenseLevel int32
+
+	for i, rule := range rules {
+		tat, ok := imdb.Db[rule.Key]
+		if !ok || tat.Before(now) {
+			tat = now
+		}
+
+		newTat := tat.Add(rule.EmissionInterval)
+		allowAt := newTat.Add(-rule.BurstTolerance)
+
+		if now.Before(allowAt) {
+			if rule.BlockTime > 0 {
+				// Bloqueia: a próxima requisição só passa depois do bloqueio. Se já estava
+				// bloqueada a política decide se ele é reiniciado.
+				block, ok := imdb.Blocks[rule.Key]
+				if ok && block.FreeAt.After(now) {
+					block.Attempts++
+					blockTime := limit_entity.PenaltyBlockTime(rule.BlockTime, block.Offenses, rule.MaxBlockTime)
+					block.FreeAt = limit_entity.BlockedUntil(rule.BlockPolicy, block.FreeAt, now, blockTime, rule.MaxBlockTime, block.Attempts)
+					if block.Offenses > 0 {
+						block.OffenseAt = block.FreeAt
+					}
+				} else {
+					// Um bloqueio novo sobe o nível de penalidade, se o anterior ainda não decaiu
+					previous := &gcraBlock{}
+					if ok {
+						previous = block
+					}
+
+					offenses := limit_entity.NextOffense(previous.Offenses, previous.OffenseAt, now, rule.PenaltyDecay)
+					block = &gcraBlock{
+						FreeAt:   now.Add(limit_entity.PenaltyBlockTime(rule.BlockTime, offenses, rule.MaxBlockTime)),
+						Attempts: 1,
+						Offenses: offenses,
+					}
+					if offenses > 0 {
+						block.OffenseAt = block.FreeAt
+					}
+					imdb.Blocks[rule.Key] = block
+				}
+
+				block.ExpiresAt = block.FreeAt
+				if block.Offenses > 0 && block.OffenseAt.Add(rule.PenaltyDecay).After(block.ExpiresAt) {
+					block.ExpiresAt = block.OffenseAt.Add(rule.PenaltyDecay)
+				}
+
+				blockedTat := block.FreeAt.Add(rule.BurstTolerance - rule.EmissionInterval)
+				imdb.Db[rule.Key] = blockedTat
+				return &limit_entity.GCRADecision{
+					Allowed:      false,
+					RetryAfter:   block.FreeAt.Sub(now),
+					Reset:        blockedTat.Sub(now),
+					DeniedRule:   i,
+					LimitingRule: i,
+					OffenseLevel: imdb.offenseLevel(rule, now),
+				}, nil
+			}
+			return &limit_entity.GCRADecision{
+				Allowed:      false,
+				RetryAfter:   allowAt.Sub(now),
+				Reset:        tat.Sub(now),
+				DeniedRule:   i,
+				LimitingRule: i,
+				OffenseLevel: imdb.offenseLevel(rule, now),
+			}, nil
+		}
+
+		newTats[i] = newTat
+
+		ruleRemaining := int32(now.Sub(allowAt) / rule.EmissionInterval)
+		if remaining < 0 || ruleRemaining < remaining {
+			remaining = ruleRemaining
+			reset = newTat.Sub(now)
+			limitingRule = i
+			offenseLevel = imdb.offenseLevel(rule, now)
+		}
+	}
+
+	for i, rule := range rules {
+		imdb.Db[rule.Key] = newTats[i]
+	}
+
+	return &limit_entity.GCRADecision{
+		Allowed:      true,
+		Remaining:    remaining,
+		Reset:        reset,
+		DeniedRule:   -1,
+		LimitingRule: limitingRule,
+		OffenseLevel: offenseLevel,
+	}, nil
+}
+
+// offenseLevel é o nível de penalidade em vigor na chave, precisa do Mutex travado
+func (imdb *InMemoryGCRALimitRepository) offenseLevel(rule limit_entity.GCRARule, now time.Time) int32 {
+	block, ok := imdb.Blocks[rule.Key]
+	if !ok {
+		return 0
+	}
+
+	return limit_entity.OffenseLevel(block.Offenses, block.OffenseAt, now, rule.PenaltyDecay)
+}
@@ -2,34 +2,71 @@ package limit
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
 )
 
+// Intervalo mínimo entre duas varreduras das entradas expiradas
+const SWEEP_INTERVAL time.Duration = 10 * time.Second
+
+// Os limits expirados somem na leitura e, nas escritas, no máximo a cada SweepInterval
+// o Db inteiro é varrido, assim chaves que nunca voltam não ficam para sempre na memória
 type InMemoryLimitRepository struct {
-	Db    map[string]*limit_entity.Limit
-	Mutex *sync.Mutex
+	Db            map[string]*limit_entity.Limit
+	AccessEntries map[limit_entity.AccessEntry]struct{}
+	Mutex         *sync.Mutex
+	SweepInterval time.Duration
+	lastSweep     time.Time
 }
 
 func NewInMemoryLimitRepository() *InMemoryLimitRepository {
 	return &InMemoryLimitRepository{
-		Db:    make(map[string]*limit_entity.Limit),
-		Mutex: &sync.Mutex{},
+		Db:            make(map[string]*limit_entity.Limit),
+		AccessEntries: make(map[limit_entity.AccessEntry]struct{}),
+		Mutex:         &sync.Mutex{},
+		SweepInterval: SWEEP_INTERVAL,
+	}
+}
+
+// sweepIfDue apaga os limits expirados se já deu o intervalo, precisa do Mutex travado
+func (imdb *InMemoryLimitRepository) sweepIfDue(now time.Time) {
+	if !sweepDue(&imdb.lastSweep, imdb.SweepInterval, now) {
+		return
+	}
+
+	for id, limit := range imdb.Db {
+		if limit.Expired(now) {
+			delete(imdb.Db, id)
+		}
 	}
 }
 
+// sweepDue diz se já passou o intervalo desde a última varredura e, se passou, marca a atual
+func sweepDue(lastSweep *time.Time, interval time.Duration, now time.Time) bool {
+	if now.Sub(*lastSweep) < interval {
+		return false
+	}
+
+	*lastSweep = now
+	return true
+}
+
 func (imdb *InMemoryLimitRepository) CreateLimit(ctx context.Context, limit *limit_entity.Limit) error {
 	imdb.Mutex.Lock()
 	defer imdb.Mutex.Unlock()
 
-	imdb.Db[limit.Id] = &limit_entity.Limit{
-		Id:      limit.Id,
-		FreeAt:  limit.FreeAt,
-		LastAt:  limit.LastAt,
-		Counter: limit.Counter,
+	now := time.Now()
+	imdb.sweepIfDue(now)
+
+	if limit.Expired(now) {
+		delete(imdb.Db, limit.Id)
+		return nil
 	}
+
+	imdb.Db[limit.Id] = limit.Clone()
 	return nil
 }
 
@@ -46,13 +83,14 @@ func (imdb *InMemoryLimitRepository) GetLimitById(ctx context.Context, id string
 		return nil, nil
 	}
 
+	if limit.Expired(time.Now()) {
+		println("getlimit: Limit expirado")
+		delete(imdb.Db, id)
+		return nil, nil
+	}
+
 	println("getlimit: Retornando o limit")
-	return &limit_entity.Limit{
-		Id:      limit.Id,
-		FreeAt:  limit.FreeAt,
-		LastAt:  limit.LastAt,
-		Counter: limit.Counter,
-	}, nil
+	return limit.Clone(), nil
 }
 
 func (imdb *InMemoryLimitRepository) UpdateLimitById(ctx context.Context, id string, newLimit *limit_entity.Limit) error {
@@ -60,20 +98,62 @@ func (imdb *InMemoryLimitRepository) UpdateLimitById(ctx context.Context, id str
 	imdb.Mutex.Lock()
 	defer imdb.Mutex.Unlock()
 
+	now := time.Now()
+	imdb.sweepIfDue(now)
+
+	if newLimit.Expired(now) {
+		delete(imdb.Db, id)
+		return nil
+	}
+
+	// Como no Redis, o limit pode ter expirado enquanto estava no cache, então volta a existir
 	limit, ok := imdb.Db[id]
 	if !ok {
-		println("repository limit não encontrado")
-		return errors.New("limit not found")
+		println("repository limit não encontrado, criando")
+		limit = &limit_entity.Limit{}
+		imdb.Db[id] = limit
 	}
 
-	*limit = limit_entity.Limit{
-		Id:      newLimit.Id,
-		FreeAt:  newLimit.FreeAt,
-		LastAt:  newLimit.LastAt,
-		Counter: newLimit.Counter,
-	}
+	*limit = *newLimit.Clone()
 
 	println("repository update terminando")
 
 	return nil
 }
+
+func (imdb *InMemoryLimitRepository) DeleteLimitById(ctx context.Context, id string) error {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	delete(imdb.Db, id)
+	return nil
+}
+
+// ListLimitIds usa o cursor como a posição na lista ordenada dos ids
+func (imdb *InMemoryLimitRepository) ListLimitIds(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	now := time.Now()
+	ids := make([]string, 0, len(imdb.Db))
+	for id, limit := range imdb.Db {
+		if !limit.Expired(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if count <= 0 {
+		count = 10
+	}
+
+	start := min(cursor, uint64(len(ids)))
+	end := min(start+uint64(count), uint64(len(ids)))
+
+	next := end
+	if end == uint64(len(ids)) {
+		next = 0
+	}
+
+	return ids[start:end], next, nil
+}
@@ -0,0 +1,114 @@
+package limit
+
+import (
+	"context"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// As fatias concedidas ficam no mesmo Db, em um limit separado por chave.
+// Counter é o total já concedido na janela que começa em WindowStart.
+func quotaLeaseKey(key string) string {
+	return "lease:" + key
+}
+
+// Mesma lógica do script Lua do RedisLimitRepository
+func (imdb *InMemoryLimitRepository) AcquireQuota(ctx context.Context, rule limit_entity.QuotaLeaseRule) (*limit_entity.QuotaLease, error) {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	now := time.Now()
+	id := quotaLeaseKey(rule.Key)
+	imdb.sweepIfDue(now)
+
+	quota, ok := imdb.Db[id]
+	if !ok || quota.Expired(now) {
+		quota = &limit_entity.Limit{Id: id}
+		imdb.Db[id] = quota
+	}
+	defer func() {
+		quota.ExpiresAt = quotaExpiresAt(quota, rule)
+	}()
+
+	level := limit_entity.OffenseLevel(quota.Offenses, quota.OffenseAt, now, rule.PenaltyDecay)
+
+	if quota.FreeAt != nil {
+		// Ainda bloqueada
+		if !quota.FreeAt.Before(now) {
+			freeAt := *quota.FreeAt
+			return &limit_entity.QuotaLease{FreeAt: &freeAt, OffenseLevel: level}, nil
+		}
+
+		// Já passou o tempo de bloqueio, começa do zero, menos a penalidade
+		*quota = limit_entity.Limit{Id: id, Offenses: quota.Offenses, OffenseAt: quota.OffenseAt}
+	}
+
+	windowStart := now.Truncate(rule.Window)
+	if !quota.WindowStart.Equal(windowStart) {
+		quota.WindowStart = windowStart
+		quota.Counter = 0
+	}
+
+	granted := min(rule.LeaseSize, rule.MaxReqs-quota.Counter)
+	if granted <= 0 {
+		if rule.BlockTime > 0 {
+			// Esgotou a janela, bloqueia a chave para todas as instâncias pelo tempo do nível
+			offenses := limit_entity.NextOffense(quota.Offenses, quota.OffenseAt, now, rule.PenaltyDecay)
+			freeAt := now.Add(limit_entity.PenaltyBlockTime(rule.BlockTime, offenses, rule.MaxBlockTime))
+			*quota = limit_entity.Limit{Id: id, FreeAt: &freeAt, LastAt: now, Offenses: offenses}
+			if offenses > 0 {
+				quota.OffenseAt = freeAt
+			}
+			return &limit_entity.QuotaLease{FreeAt: &freeAt, OffenseLevel: offenses}, nil
+		}
+
+		return &limit_entity.QuotaLease{
+			WindowStart:  windowStart,
+			WindowEnd:    windowStart.Add(rule.Window),
+			OffenseLevel: level,
+		}, nil
+	}
+
+	quota.LastAt = now
+	quota.Counter += granted
+
+	return &limit_entity.QuotaLease{
+		Granted:      granted,
+		Available:    rule.MaxReqs - quota.Counter,
+		WindowStart:  windowStart,
+		WindowEnd:    windowStart.Add(rule.Window),
+		OffenseLevel: level,
+	}, nil
+}
+
+// A quota só importa até o fim da janela ou do bloqueio e enquanto a penalidade não decai,
+// como o PEXPIRE do script Lua
+func quotaExpiresAt(quota *limit_entity.Limit, rule limit_entity.QuotaLeaseRule) time.Time {
+	expiresAt := quota.WindowStart.Add(rule.Window)
+	if quota.FreeAt != nil && quota.FreeAt.After(expiresAt) {
+		expiresAt = *quota.FreeAt
+	}
+
+	if quota.Offenses > 0 {
+		if offenseEnd := quota.OffenseAt.Add(rule.PenaltyDecay); offenseEnd.After(expiresAt) {
+			expiresAt = offenseEnd
+		}
+	}
+
+	return expiresAt
+}
+
+func (imdb *InMemoryLimitRepository) ReleaseQuota(ctx context.Context, key string, windowStart time.Time, unused int32) error {
+	imdb.Mutex.Lock()
+	defer imdb.Mutex.Unlock()
+
+	quota, ok := imdb.Db[quotaLeaseKey(key)]
+	if !ok || quota.Expired(time.Now()) || quota.FreeAt != nil || !quota.WindowStart.Equal(windowStart) {
+		return nil
+	}
+
+	quota.Counter -= min(unused, quota.Counter)
+
+	return nil
+}
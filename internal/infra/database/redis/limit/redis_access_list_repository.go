@@ -0,0 +1,50 @@
+package limit
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// As entradas ficam em um set só, cada membro é action:kind:value
+const accessListKey = "access_list"
+
+func accessListMember(entry limit_entity.AccessEntry) string {
+	return entry.Action + ":" + entry.Kind + ":" + entry.Value
+}
+
+func (r *RedisLimitRepository) ListAccessEntries(ctx context.Context) ([]limit_entity.AccessEntry, error) {
+	members, err := r.Rdb.SMembers(ctx, r.key(accessListKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(members)
+
+	entries := make([]limit_entity.AccessEntry, 0, len(members))
+	for _, member := range members {
+		// O value pode ter dois pontos, ex: um CIDR IPv6
+		parts := strings.SplitN(member, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		entries = append(entries, limit_entity.AccessEntry{
+			Action: parts[0],
+			Kind:   parts[1],
+			Value:  parts[2],
+		})
+	}
+
+	return entries, nil
+}
+
+func (r *RedisLimitRepository) AddAccessEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	return r.Rdb.SAdd(ctx, r.key(accessListKey), accessListMember(entry)).Err()
+}
+
+func (r *RedisLimitRepository) RemoveAccessEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	return r.Rdb.SRem(ctx, r.key(accessListKey), accessListMember(entry)).Err()
+}
@@ -0,0 +1,156 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/redis/go-redis/v9"
+)
+
+// O RedisAtomicLimitRepository também é um LimitEntityRepository para que a API de
+// administração veja e altere o estado gravado pelo script. Os tempos lá ficam em
+// microssegundos, zero é ausente, e os timestamps do sliding window log ficam no sorted set.
+
+func (r *RedisAtomicLimitRepository) stateKey(id string) string {
+	return prefixedKey(r.KeyPrefix, atomicKeyPrefix+id)
+}
+
+func (r *RedisAtomicLimitRepository) logKey(id string) string {
+	return r.stateKey(id) + atomicLogSuffix
+}
+
+func fromMicro(us float64) time.Time {
+	if us == 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMicro(int64(us))
+}
+
+func toMicro(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixMicro()
+}
+
+func (r *RedisAtomicLimitRepository) GetLimitById(ctx context.Context, id string) (*limit_entity.Limit, error) {
+	raw, err := r.Rdb.HGetAll(ctx, r.stateKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	fields := make(map[string]float64, len(raw))
+	for name, value := range raw {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in atomic limit %s: %w", name, id, err)
+		}
+		fields[name] = number
+	}
+
+	limit := &limit_entity.Limit{
+		Id:          id,
+		LastAt:      fromMicro(fields["last_at"]),
+		Counter:     int32(fields["counter"]),
+		Tokens:      fields["tokens"],
+		WindowStart: fromMicro(fields["window_start"]),
+		PrevCounter: int32(fields["prev_counter"]),
+		Offenses:    int32(fields["offenses"]),
+		OffenseAt:   fromMicro(fields["offense_at"]),
+		ExpiresAt:   fromMicro(fields["expires_at"]),
+	}
+
+	if fields["free_at"] > 0 {
+		freeAt := fromMicro(fields["free_at"])
+		limit.FreeAt = &freeAt
+	}
+
+	scores, err := r.Rdb.ZRangeWithScores(ctx, r.logKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, score := range scores {
+		limit.Timestamps = append(limit.Timestamps, fromMicro(score.Score))
+	}
+
+	return limit, nil
+}
+
+func (r *RedisAtomicLimitRepository) CreateLimit(ctx context.Context, limit *limit_entity.Limit) error {
+	return r.UpdateLimitById(ctx, limit.Id, limit)
+}
+
+// UpdateLimitById grava o estado inteiro, inclusive o log, em uma transação
+func (r *RedisAtomicLimitRepository) UpdateLimitById(ctx context.Context, id string, limit *limit_entity.Limit) error {
+	if limit.Expired(time.Now()) {
+		return r.DeleteLimitById(ctx, id)
+	}
+
+	var freeAt int64
+	if limit.FreeAt != nil {
+		freeAt = toMicro(*limit.FreeAt)
+	}
+
+	_, err := r.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.stateKey(id),
+			"free_at", freeAt,
+			"last_at", toMicro(limit.LastAt),
+			"counter", limit.Counter,
+			"tokens", limit.Tokens,
+			"window_start", toMicro(limit.WindowStart),
+			"prev_counter", limit.PrevCounter,
+			"offenses", limit.Offenses,
+			"offense_at", toMicro(limit.OffenseAt),
+			"expires_at", toMicro(limit.ExpiresAt),
+		)
+
+		pipe.Del(ctx, r.logKey(id))
+		for i, t := range limit.Timestamps {
+			pipe.ZAdd(ctx, r.logKey(id), redis.Z{
+				Score:  float64(toMicro(t)),
+				Member: fmt.Sprintf("%d:%d", toMicro(t), i),
+			})
+		}
+
+		if !limit.ExpiresAt.IsZero() {
+			pipe.PExpireAt(ctx, r.stateKey(id), limit.ExpiresAt)
+			pipe.PExpireAt(ctx, r.logKey(id), limit.ExpiresAt)
+		} else {
+			pipe.Persist(ctx, r.stateKey(id))
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisAtomicLimitRepository) DeleteLimitById(ctx context.Context, id string) error {
+	return r.Rdb.Del(ctx, r.stateKey(id), r.logKey(id)).Err()
+}
+
+// ListLimitIds é um SCAN pelos hashes de estado, os logs são sorted sets e ficam de fora
+func (r *RedisAtomicLimitRepository) ListLimitIds(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	keys, next, err := scanKeys(ctx, r.Rdb, cursor, r.stateKey("*"), count, "hash")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, r.stateKey(""))
+	}
+
+	return ids, next, nil
+}
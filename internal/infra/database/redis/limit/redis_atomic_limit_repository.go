@@ -0,0 +1,410 @@
+package limit
+
+import (
+	"context"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/redis/go-redis/v9"
+)
+
+// O script replica, dentro do Redis, os algoritmos e o bloqueio do LimitUseCase.
+// Cada regra usa duas chaves: um hash com o estado e um sorted set com o log do
+// sliding window log. Os tempos ficam em microssegundos e o relógio é o do Redis.
+// Todas as regras são avaliadas antes de gravar; se uma nega, só o estado dela é gravado.
+// O nível da penalidade progressiva fica no hash e sobrevive ao fim do bloqueio.
+// As duas chaves expiram quando o estado deixa de influenciar qualquer decisão.
+// ARGV traz algorithm, max_reqs, window, burst, block, block_policy, max_block e
+// penalty_decay de cada regra, nessa ordem.
+// Retorna {allowed, retry_after_us, denied_rule, limit, remaining, reset_us, offense_level},
+// os quatro últimos da regra que negou ou, quando passa, da regra com menos requisições restantes.
+var atomicLimitScript = redis.NewScript(`
+local now_parts = redis.call('TIME')
+local now = tonumber(now_parts[1]) * 1000000 + tonumber(now_parts[2])
+` + penaltyScript + `
+local function empty_state()
+	return {free_at = 0, last_at = 0, counter = 0, tokens = 0, window_start = 0, prev_counter = 0, seq = 0, offenses = 0, offense_at = 0}
+end
+
+-- Estado zerado, menos a penalidade
+local function reset_state(state)
+	local reset = empty_state()
+	reset.offenses = state.offenses
+	reset.offense_at = state.offense_at
+	return reset
+end
+
+local function load(state_key)
+	local state = empty_state()
+	local raw = redis.call('HGETALL', state_key)
+	for i = 1, #raw, 2 do
+		state[raw[i]] = tonumber(raw[i + 1])
+	end
+	return state
+end
+
+-- Mesma conta do usecase.limitExpiresAt
+local function expires_at(rule, state)
+	local at
+	if rule.algorithm == 'token_bucket' then
+		local capacity = rule.burst
+		if capacity <= 0 then
+			capacity = rule.max_reqs
+		end
+		at = state.last_at + rule.window * capacity / math.max(1, rule.max_reqs)
+	elseif rule.algorithm == 'sliding_window_counter' then
+		at = state.window_start + 2 * rule.window
+	else
+		at = state.last_at + rule.window
+	end
+
+	at = math.max(at, state.free_at)
+	if state.offenses > 0 then
+		at = math.max(at, state.offense_at + rule.penalty_decay)
+	end
+	return math.ceil(at)
+end
+
+-- Grava depois do ZADD, o PEXPIREAT só vale para chaves que já existem
+local function save(rule, state_key, log_key, state)
+	state.expires_at = expires_at(rule, state)
+	redis.call('HSET', state_key,
+		'free_at', state.free_at,
+		'last_at', state.last_at,
+		'counter', state.counter,
+		'tokens', state.tokens,
+		'window_start', state.window_start,
+		'prev_counter', state.prev_counter,
+		'seq', state.seq,
+		'offenses', state.offenses,
+		'offense_at', state.offense_at,
+		'expires_at', state.expires_at)
+	local expires_ms = math.ceil(state.expires_at / 1000)
+	redis.call('PEXPIREAT', state_key, expires_ms)
+	redis.call('PEXPIREAT', log_key, expires_ms)
+end
+
+-- Mesma política do limit_entity.BlockedUntil, attempts conta a requisição que bloqueou
+local function blocked_until(rule, block, free_at, attempts)
+	if rule.block_policy == 'fixed' then
+		return free_at
+	end
+
+	if rule.block_policy == 'exponential' and block > 0 then
+		block = math.min(block * 2 ^ (attempts - 1), rule.max_block)
+	end
+
+	return math.max(free_at, now + block)
+end
+
+local algorithms = {}
+
+algorithms.fixed_window = function(state, rule, log_key)
+	-- Passou uma janela sem requisição
+	if now - state.last_at > rule.window then
+		state.last_at = now
+		state.counter = 1
+		return true
+	end
+
+	if state.counter + 1 > rule.max_reqs then
+		return false
+	end
+
+	state.last_at = now
+	state.counter = state.counter + 1
+	return true
+end
+
+algorithms.sliding_window_log = function(state, rule, log_key)
+	-- Descartar o que saiu da janela não muda a decisão, pode ser feito já
+	redis.call('ZREMRANGEBYSCORE', log_key, '-inf', now - rule.window)
+	state.counter = redis.call('ZCARD', log_key)
+
+	if state.counter >= rule.max_reqs then
+		return false
+	end
+
+	-- O ZADD só acontece se todas as regras passarem
+	state.seq = state.seq + 1
+	state.log_member = string.format('%d:%d', now, state.seq)
+	state.last_at = now
+	state.counter = state.counter + 1
+	return true
+end
+
+algorithms.token_bucket = function(state, rule, log_key)
+	local capacity = rule.burst
+	if capacity <= 0 then
+		capacity = rule.max_reqs
+	end
+
+	-- Primeira requisição, o balde começa cheio
+	if state.last_at == 0 then
+		state.tokens = capacity
+	else
+		local refill = (now - state.last_at) / rule.window * rule.max_reqs
+		state.tokens = math.min(capacity, state.tokens + refill)
+	end
+	state.last_at = now
+
+	if state.tokens < 1 then
+		return false
+	end
+
+	state.tokens = state.tokens - 1
+	state.counter = math.floor(capacity - state.tokens)
+	return true
+end
+
+algorithms.sliding_window_counter = function(state, rule, log_key)
+	local current_start = now - (now % rule.window)
+	if current_start - state.window_start == rule.window then
+		-- A janela atual virou a anterior
+		state.prev_counter = state.counter
+		state.counter = 0
+	elseif current_start ~= state.window_start then
+		-- Passou mais de uma janela sem requisição
+		state.prev_counter = 0
+		state.counter = 0
+	end
+	state.window_start = current_start
+
+	local prev_weight = 1 - (now - current_start) / rule.window
+	local estimated = state.prev_counter * prev_weight + state.counter
+
+	if estimated + 1 > rule.max_reqs then
+		return false
+	end
+
+	state.last_at = now
+	state.counter = state.counter + 1
+	return true
+end
+
+-- Cada status lê o estado já avaliado e devolve limit, remaining, reset e retry_after
+local statuses = {}
+
+local function limit_of(rule)
+	if rule.algorithm == 'token_bucket' and rule.burst > 0 then
+		return rule.burst
+	end
+	return rule.max_reqs
+end
+
+statuses.fixed_window = function(state, rule, log_key)
+	-- O counter zera uma janela depois da última requisição
+	local reset = math.max(0, state.last_at + rule.window - now)
+	local remaining = math.max(0, rule.max_reqs - state.counter)
+	local retry_after = 0
+	if remaining == 0 then
+		retry_after = reset
+	end
+	return rule.max_reqs, remaining, reset, retry_after
+end
+
+statuses.sliding_window_log = function(state, rule, log_key)
+	-- O counter já conta a requisição pendente, que ainda não está no log
+	local logged = state.counter
+	if state.log_member then
+		logged = logged - 1
+	end
+
+	local function score_at(index)
+		if index >= logged then
+			return now
+		end
+		return tonumber(redis.call('ZRANGE', log_key, index, index, 'WITHSCORES')[2])
+	end
+
+	local remaining = math.max(0, rule.max_reqs - state.counter)
+	local reset = 0
+	local retry_after = 0
+	if state.counter > 0 then
+		-- O limite está inteiro quando o mais novo sai da janela
+		reset = math.max(0, score_at(state.counter - 1) + rule.window - now)
+		if remaining == 0 then
+			-- Passa quando sair da janela o suficiente para caber mais uma
+			retry_after = math.max(0, score_at(math.max(0, state.counter - rule.max_reqs)) + rule.window - now)
+		end
+	end
+	return rule.max_reqs, remaining, reset, retry_after
+end
+
+statuses.token_bucket = function(state, rule, log_key)
+	local capacity = limit_of(rule)
+	-- Tempo para repor um token
+	local per_token = rule.window / math.max(1, rule.max_reqs)
+	local retry_after = 0
+	if state.tokens < 1 then
+		retry_after = (1 - state.tokens) * per_token
+	end
+	return capacity, math.floor(math.max(0, state.tokens)), (capacity - state.tokens) * per_token, retry_after
+end
+
+statuses.sliding_window_counter = function(state, rule, log_key)
+	local window_end = state.window_start + rule.window
+	local prev_weight = 1 - (now - state.window_start) / rule.window
+	local estimated = state.prev_counter * prev_weight + state.counter
+
+	local remaining = math.floor(math.max(0, rule.max_reqs - estimated))
+	local reset = math.max(0, window_end - now)
+	if remaining > 0 then
+		return rule.max_reqs, remaining, reset, 0
+	end
+
+	-- Espaço que a janela anterior precisa deixar para caber mais uma
+	local room = rule.max_reqs - 1 - state.counter
+	local free_at
+	if room >= 0 and state.prev_counter > 0 then
+		free_at = state.window_start + rule.window * (1 - room / state.prev_counter)
+	elseif room >= 0 then
+		free_at = now
+	else
+		-- Só na próxima janela, quando a atual passar a ser a anterior
+		free_at = window_end + rule.window * math.min(1, 1 - (rule.max_reqs - 1) / state.counter)
+	end
+	return rule.max_reqs, remaining, reset, math.max(0, free_at - now)
+end
+
+local passed = {}
+local limiting = nil
+
+for i = 1, #KEYS / 2 do
+	local base = (i - 1) * 8
+	local rule = {
+		algorithm = ARGV[base + 1],
+		max_reqs = tonumber(ARGV[base + 2]),
+		window = tonumber(ARGV[base + 3]),
+		burst = tonumber(ARGV[base + 4]),
+		block = tonumber(ARGV[base + 5]),
+		block_policy = ARGV[base + 6],
+		max_block = tonumber(ARGV[base + 7]),
+		penalty_decay = tonumber(ARGV[base + 8]),
+	}
+	local state_key = KEYS[i * 2 - 1]
+	local log_key = KEYS[i * 2]
+
+	local algorithm = algorithms[rule.algorithm]
+	if not algorithm then
+		return redis.error_reply('unknown limit algorithm: ' .. rule.algorithm)
+	end
+
+	local state = load(state_key)
+
+	if state.free_at > 0 then
+		if state.free_at >= now then
+			-- Não passou o tempo de bloqueio, a política decide se ele é reiniciado.
+			-- No exponencial counter conta as requisições recebidas durante o bloqueio.
+			if rule.block_policy == 'exponential' then
+				state.counter = state.counter + 1
+			end
+			local block = penalty_block(rule.block, state.offenses, rule.max_block)
+			state.free_at = blocked_until(rule, block, state.free_at, state.counter)
+			state.last_at = now
+			if state.offenses > 0 then
+				state.offense_at = state.free_at
+			end
+			save(rule, state_key, log_key, state)
+			local level = offense_level(state.offenses, state.offense_at, rule.penalty_decay)
+			return {0, state.free_at - now, i - 1, limit_of(rule), 0, state.free_at - now, level}
+		end
+
+		-- Já passou o tempo de bloqueio, começa do zero, menos a penalidade
+		redis.call('DEL', state_key, log_key)
+		state = reset_state(state)
+	end
+
+	local level = offense_level(state.offenses, state.offense_at, rule.penalty_decay)
+
+	if not algorithm(state, rule, log_key) then
+		if rule.block > 0 then
+			-- Atingiu o limite, bloqueia pelo tempo do nível de penalidade
+			redis.call('DEL', log_key)
+			local offenses = next_offense(state.offenses, state.offense_at, rule.penalty_decay)
+			local block = penalty_block(rule.block, offenses, rule.max_block)
+			state = empty_state()
+			state.free_at = now + block
+			state.last_at = now
+			state.counter = 1
+			state.offenses = offenses
+			if offenses > 0 then
+				state.offense_at = state.free_at
+			end
+			save(rule, state_key, log_key, state)
+			return {0, block, i - 1, limit_of(rule), 0, block, offenses}
+		end
+
+		-- Sem tempo de bloqueio só nega, preservando o estado do algoritmo
+		local limit, remaining, reset, retry_after = statuses[rule.algorithm](state, rule, log_key)
+		save(rule, state_key, log_key, state)
+		return {0, retry_after, i - 1, limit, remaining, reset, level}
+	end
+
+	passed[i] = {rule = rule, state_key = state_key, log_key = log_key, state = state}
+
+	local limit, remaining, reset = statuses[rule.algorithm](state, rule, log_key)
+	if not limiting or remaining < limiting[2] then
+		limiting = {limit, remaining, reset, level}
+	end
+end
+
+for _, pass in ipairs(passed) do
+	if pass.state.log_member then
+		redis.call('ZADD', pass.log_key, now, pass.state.log_member)
+	end
+	save(pass.rule, pass.state_key, pass.log_key, pass.state)
+end
+
+return {1, 0, -1, limiting[1], limiting[2], limiting[3], limiting[4]}
+`)
+
+// KeyPrefix vai na frente de todas as chaves gravadas, vazio mantém o formato legado
+type RedisAtomicLimitRepository struct {
+	Rdb       redis.UniversalClient
+	KeyPrefix string
+}
+
+func NewRedisAtomicLimitRepository(host string, port string) *RedisAtomicLimitRepository {
+	return NewRedisAtomicLimitRepositoryWithClient(redis.NewClient(NewRedisOptions(host, port)))
+}
+
+func NewRedisAtomicLimitRepositoryWithClient(rdb redis.UniversalClient) *RedisAtomicLimitRepository {
+	return &RedisAtomicLimitRepository{
+		Rdb: rdb,
+	}
+}
+
+func (r *RedisAtomicLimitRepository) EvaluateLimit(ctx context.Context, rules []limit_entity.AtomicLimitRule) (*limit_entity.AtomicLimitDecision, error) {
+	keys := make([]string, 0, len(rules)*2)
+	args := make([]interface{}, 0, len(rules)*8)
+	for _, rule := range rules {
+		keys = append(keys, r.stateKey(rule.Key), r.logKey(rule.Key))
+		args = append(args,
+			rule.Algorithm,
+			rule.MaxReqs,
+			rule.Window.Microseconds(),
+			rule.Burst,
+			rule.BlockTime.Microseconds(),
+			rule.BlockPolicy,
+			rule.MaxBlockTime.Microseconds(),
+			rule.PenaltyDecay.Microseconds(),
+		)
+	}
+
+	// Run usa EVALSHA e só envia o script inteiro quando o Redis ainda não o conhece
+	result, err := atomicLimitScript.Run(ctx, r.Rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &limit_entity.AtomicLimitDecision{
+		Allowed:      result[0] == 1,
+		RetryAfter:   time.Duration(result[1]) * time.Microsecond,
+		DeniedRule:   int(result[2]),
+		Limit:        int32(result[3]),
+		Remaining:    int32(result[4]),
+		Reset:        time.Duration(result[5]) * time.Microsecond,
+		OffenseLevel: int32(result[6]),
+	}, nil
+}
@@ -0,0 +1,41 @@
+package limit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanKeys é o SCAN das listagens e da migração, keyType vazio não filtra pelo tipo. No Cluster
+// cada master tem só as chaves dos seus slots e o cursor de um não vale nos outros, então todos
+// são percorridos até o fim e tudo volta numa página só, com o próximo cursor 0.
+func scanKeys(ctx context.Context, rdb redis.UniversalClient, cursor uint64, match string, count int64, keyType string) ([]string, uint64, error) {
+	cluster, ok := rdb.(*redis.ClusterClient)
+	if !ok {
+		return scan(ctx, rdb, cursor, match, count, keyType).Result()
+	}
+
+	var mutex sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		iter := scan(ctx, master, 0, match, count, keyType).Iterator()
+		for iter.Next(ctx) {
+			mutex.Lock()
+			keys = append(keys, iter.Val())
+			mutex.Unlock()
+		}
+
+		return iter.Err()
+	})
+
+	return keys, 0, err
+}
+
+func scan(ctx context.Context, rdb redis.Cmdable, cursor uint64, match string, count int64, keyType string) *redis.ScanCmd {
+	if keyType == "" {
+		return rdb.Scan(ctx, cursor, match, count)
+	}
+
+	return rdb.ScanType(ctx, cursor, match, count, keyType)
+}
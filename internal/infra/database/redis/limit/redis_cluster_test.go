@@ -0,0 +1,192 @@
+package limit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// newTestCluster sobe dois masters em memória, o primeiro com os slots 0-8191 e o segundo com
+// 8192-16383. O miniredis aceita qualquer chave, então cada uma fica no master para onde o
+// ClusterClient a mandou.
+func newTestCluster(t *testing.T) (*redis.ClusterClient, []*miniredis.Miniredis) {
+	nodes := []*miniredis.Miniredis{miniredis.RunT(t), miniredis.RunT(t)}
+
+	rdb := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(ctx context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: nodes[0].Addr()}}},
+				{Start: 8192, End: 16383, Nodes: []redis.ClusterNode{{Addr: nodes[1].Addr()}}},
+			}, nil
+		},
+	})
+	t.Cleanup(func() { rdb.Close() })
+
+	return rdb, nodes
+}
+
+// keySlot é o slot do Redis Cluster: CRC16 da hash tag, ou da chave inteira sem ela
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return int(crc) % 16384
+}
+
+func TestKeySlot(t *testing.T) {
+	assert.Equal(t, 12739, keySlot("123456789"))
+	assert.Equal(t, keySlot("203.0.113.7"), keySlot("rl:test:atomic:ip:{203.0.113.7}:second:log"))
+
+	// Os ids dos testes de cluster caem em masters diferentes
+	assert.Less(t, keySlot("203.0.113.8"), 8192)
+	assert.GreaterOrEqual(t, keySlot("203.0.113.7"), 8192)
+}
+
+func TestScanKeys_Should_scan_every_cluster_master(t *testing.T) {
+	ctx := context.Background()
+	rdb, nodes := newTestCluster(t)
+
+	require.NoError(t, rdb.Set(ctx, "ip:{203.0.113.8}", "1", 0).Err())
+	require.NoError(t, rdb.Set(ctx, "ip:{203.0.113.7}", "1", 0).Err())
+	require.NoError(t, rdb.HSet(ctx, "hash:{203.0.113.7}", "last_at", "1").Err())
+
+	// Cada chave está só no master do seu slot
+	assert.Equal(t, []string{"ip:{203.0.113.8}"}, nodes[0].Keys())
+	assert.Equal(t, []string{"hash:{203.0.113.7}", "ip:{203.0.113.7}"}, nodes[1].Keys())
+
+	// O cursor pedido não vale entre masters, todos são percorridos do início
+	keys, next, err := scanKeys(ctx, rdb, 0, "*", 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"ip:{203.0.113.8}", "ip:{203.0.113.7}", "hash:{203.0.113.7}"}, keys)
+
+	keys, next, err = scanKeys(ctx, rdb, 0, "ip:*", 10, "string")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"ip:{203.0.113.8}", "ip:{203.0.113.7}"}, keys)
+
+	keys, _, err = scanKeys(ctx, rdb, 0, "*", 10, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hash:{203.0.113.7}"}, keys)
+}
+
+func TestScanKeys_Should_keep_the_cursor_outside_a_cluster(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, rdb.Set(ctx, key, "1", 0).Err())
+	}
+
+	var all []string
+	var cursor uint64
+	for {
+		keys, next, err := scanKeys(ctx, rdb, cursor, "*", 1, "")
+		require.NoError(t, err)
+		all = append(all, keys...)
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, all)
+}
+
+func TestRedisLimitRepository_Should_list_and_migrate_through_a_cluster(t *testing.T) {
+	ctx := context.Background()
+	rdb, nodes := newTestCluster(t)
+
+	repository := NewRedisLimitRepositoryWithClient(rdb)
+	for _, id := range []string{"203.0.113.8", "203.0.113.7"} {
+		require.NoError(t, repository.CreateLimit(ctx, &limit_entity.Limit{Id: id, Counter: 1, LastAt: time.Now()}))
+	}
+	require.NoError(t, rdb.Set(ctx, "other:{203.0.113.8}", "1", 0).Err())
+
+	ids, next, err := repository.ListLimitIds(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"203.0.113.8", "203.0.113.7"}, ids)
+
+	migrator := NewRedisLimitRepositoryWithClient(rdb)
+	migrator.KeyPrefix = "rl:test"
+	migrated, err := migrator.MigrateLegacyKeys(ctx, func(id string) string {
+		return "ip:{" + id + "}"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+
+	// A chave nova está no slot da hash tag, não no da chave legada
+	assert.ElementsMatch(t, []string{"other:{203.0.113.8}", "rl:test:ip:{203.0.113.8}"}, nodes[0].Keys())
+	assert.Equal(t, []string{"rl:test:ip:{203.0.113.7}"}, nodes[1].Keys())
+
+	ids, next, err = migrator.ListLimitIds(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"ip:{203.0.113.8}", "ip:{203.0.113.7}"}, ids)
+
+	limit, err := migrator.GetLimitById(ctx, "ip:{203.0.113.7}")
+	require.NoError(t, err)
+	require.NotNil(t, limit)
+	assert.Equal(t, "ip:{203.0.113.7}", limit.Id)
+	assert.Equal(t, int32(1), limit.Counter)
+}
+
+func TestRedisAtomicLimitRepository_Should_keep_the_tiers_of_a_key_in_one_cluster_slot(t *testing.T) {
+	ctx := context.Background()
+	rdb, nodes := newTestCluster(t)
+
+	repository := NewRedisAtomicLimitRepositoryWithClient(rdb)
+	repository.KeyPrefix = "rl:test"
+
+	rules := []limit_entity.AtomicLimitRule{
+		{Key: "ip:{203.0.113.7}:second", Algorithm: "sliding_window_log", MaxReqs: 2, Window: time.Second, BlockTime: 5 * time.Second},
+		{Key: "ip:{203.0.113.7}:minute", Algorithm: "sliding_window_log", MaxReqs: 10, Window: time.Minute, BlockTime: 5 * time.Second},
+	}
+
+	for _, allowed := range []bool{true, true, false} {
+		decision, err := repository.EvaluateLimit(ctx, rules)
+		require.NoError(t, err)
+		assert.Equal(t, allowed, decision.Allowed)
+	}
+
+	// O estado e o log de todos os tiers têm a mesma hash tag, então o mesmo slot e o mesmo master
+	assert.Empty(t, nodes[0].Keys())
+	keys := nodes[1].Keys()
+	require.NotEmpty(t, keys)
+	for _, key := range keys {
+		assert.Equal(t, 1, strings.Count(key, "{"), key)
+		assert.Equal(t, keySlot("203.0.113.7"), keySlot(key), key)
+	}
+
+	// A listagem percorre os masters e volta numa página só
+	ids, next, err := repository.ListLimitIds(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"ip:{203.0.113.7}:second", "ip:{203.0.113.7}:minute"}, ids)
+}
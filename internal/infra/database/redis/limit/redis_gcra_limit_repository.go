@@ -0,0 +1,171 @@
+package limit
+
+import (
+	"context"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/redis/go-redis/v9"
+)
+
+// O script guarda o TAT (theoretical arrival time) em microssegundos por chave e, a partir de
+// um bloqueio, uma segunda chave com o fim dele, as requisições recebidas e o nível de
+// penalidade. Ela expira quando o bloqueio e a penalidade acabam.
+// O relógio é o do Redis para que todas as instâncias concordem.
+// Todas as chaves são verificadas antes de qualquer escrita, uma negação não consome as demais.
+// KEYS traz a chave do TAT e a do bloqueio de cada regra.
+// ARGV traz interval, tolerance, block, block_policy, max_block e penalty_decay de cada regra,
+// nessa ordem.
+// Retorna {allowed, retry_after_us, remaining, denied_rule, reset_us, limiting_rule, offense_level}.
+var gcraScript = redis.NewScript(`
+local now_parts = redis.call('TIME')
+local now = tonumber(now_parts[1]) * 1000000 + tonumber(now_parts[2])
+` + penaltyScript + `
+-- Mesma política do limit_entity.BlockedUntil, attempts conta a requisição que bloqueou
+local function blocked_until(policy, free_at, block, max_block, attempts)
+	if policy == 'fixed' then
+		return free_at
+	end
+
+	if policy == 'exponential' then
+		block = math.min(block * 2 ^ (attempts - 1), max_block)
+	end
+
+	return math.max(free_at, now + block)
+end
+
+local function current_level(block_key, decay)
+	if decay <= 0 then
+		return 0
+	end
+	local current = redis.call('HMGET', block_key, 'offenses', 'offense_at')
+	return offense_level(tonumber(current[1]) or 0, tonumber(current[2]) or 0, decay)
+end
+
+local new_tats = {}
+local remaining = -1
+local reset = 0
+local limiting_rule = 0
+local limiting_level = 0
+
+for i = 1, #KEYS / 2 do
+	local interval = tonumber(ARGV[(i - 1) * 6 + 1])
+	local tolerance = tonumber(ARGV[(i - 1) * 6 + 2])
+	local block = tonumber(ARGV[(i - 1) * 6 + 3])
+	local block_policy = ARGV[(i - 1) * 6 + 4]
+	local max_block = tonumber(ARGV[(i - 1) * 6 + 5])
+	local penalty_decay = tonumber(ARGV[(i - 1) * 6 + 6])
+	local tat_key = KEYS[i * 2 - 1]
+	local block_key = KEYS[i * 2]
+
+	local tat = tonumber(redis.call('GET', tat_key))
+	if not tat or tat < now then
+		tat = now
+	end
+
+	local new_tat = tat + interval
+	local allow_at = new_tat - tolerance
+
+	if now < allow_at then
+		if block > 0 then
+			-- Bloqueia: a próxima requisição só passa depois do bloqueio. Se já estava
+			-- bloqueada a política decide se ele é reiniciado.
+			local current = redis.call('HMGET', block_key, 'attempts', 'free_at', 'offenses', 'offense_at')
+			local current_free_at = tonumber(current[2])
+			local attempts = 1
+			local offenses = tonumber(current[3]) or 0
+			local offense_at = tonumber(current[4]) or 0
+			local free_at
+			if current_free_at and current_free_at > now then
+				attempts = tonumber(current[1]) + 1
+				free_at = blocked_until(block_policy, current_free_at, penalty_block(block, offenses, max_block), max_block, attempts)
+				if offenses > 0 then
+					offense_at = free_at
+				end
+			else
+				-- Um bloqueio novo sobe o nível de penalidade, se o anterior ainda não decaiu
+				offenses = next_offense(offenses, offense_at, penalty_decay)
+				free_at = now + penalty_block(block, offenses, max_block)
+				if offenses > 0 then
+					offense_at = free_at
+				end
+			end
+
+			local blocked_tat = free_at + tolerance - interval
+			redis.call('SET', tat_key, blocked_tat, 'PX', math.max(1, math.ceil((blocked_tat - now) / 1000)))
+			redis.call('HSET', block_key, 'attempts', attempts, 'free_at', free_at, 'offenses', offenses, 'offense_at', offense_at)
+			local expires_at = free_at
+			if offenses > 0 then
+				expires_at = math.max(free_at, offense_at + penalty_decay)
+			end
+			redis.call('PEXPIRE', block_key, math.max(1, math.ceil((expires_at - now) / 1000)))
+			return {0, free_at - now, 0, i - 1, blocked_tat - now, i - 1, offense_level(offenses, offense_at, penalty_decay)}
+		end
+		return {0, allow_at - now, 0, i - 1, tat - now, i - 1, current_level(block_key, penalty_decay)}
+	end
+
+	new_tats[i] = new_tat
+
+	local rule_remaining = math.floor((now - allow_at) / interval)
+	if remaining < 0 or rule_remaining < remaining then
+		remaining = rule_remaining
+		reset = new_tat - now
+		limiting_rule = i - 1
+		limiting_level = current_level(block_key, penalty_decay)
+	end
+end
+
+for i = 1, #KEYS / 2 do
+	redis.call('SET', KEYS[i * 2 - 1], new_tats[i], 'PX', math.max(1, math.ceil((new_tats[i] - now) / 1000)))
+end
+
+return {1, 0, remaining, -1, reset, limiting_rule, limiting_level}
+`)
+
+// KeyPrefix vai na frente de todas as chaves gravadas, vazio mantém o formato legado
+type RedisGCRALimitRepository struct {
+	Rdb       redis.UniversalClient
+	KeyPrefix string
+}
+
+func NewRedisGCRALimitRepository(host string, port string) *RedisGCRALimitRepository {
+	return NewRedisGCRALimitRepositoryWithClient(redis.NewClient(NewRedisOptions(host, port)))
+}
+
+func NewRedisGCRALimitRepositoryWithClient(rdb redis.UniversalClient) *RedisGCRALimitRepository {
+	return &RedisGCRALimitRepository{
+		Rdb: rdb,
+	}
+}
+
+func (r *RedisGCRALimitRepository) AllowGCRA(ctx context.Context, rules []limit_entity.GCRARule) (*limit_entity.GCRADecision, error) {
+	keys := make([]string, 0, len(rules)*2)
+	args := make([]interface{}, 0, len(rules)*6)
+	for _, rule := range rules {
+		key := prefixedKey(r.KeyPrefix, gcraKeyPrefix+rule.Key)
+		keys = append(keys, key, key+gcraBlockSuffix)
+		args = append(args,
+			rule.EmissionInterval.Microseconds(),
+			rule.BurstTolerance.Microseconds(),
+			rule.BlockTime.Microseconds(),
+			rule.BlockPolicy,
+			rule.MaxBlockTime.Microseconds(),
+			rule.PenaltyDecay.Microseconds(),
+		)
+	}
+
+	result, err := gcraScript.Run(ctx, r.Rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &limit_entity.GCRADecision{
+		Allowed:      result[0] == 1,
+		RetryAfter:   time.Duration(result[1]) * time.Microsecond,
+		Remaining:    int32(result[2]),
+		Reset:        time.Duration(result[4]) * time.Microsecond,
+		DeniedRule:   int(result[3]),
+		LimitingRule: int(result[5]),
+		OffenseLevel: int32(result[6]),
+	}, nil
+}
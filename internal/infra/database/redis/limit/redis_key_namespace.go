@@ -0,0 +1,180 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cada strategy grava as chaves com o próprio prefixo, depois do KeyPrefix do repository:
+// rl:prod:atomic:ip:{1.2.3.4}. As chaves derivadas só acrescentam um sufixo ao id, então com
+// o id entre {} todas caem no mesmo slot do Redis Cluster.
+const (
+	atomicKeyPrefix = "atomic:"
+	atomicLogSuffix = ":log"
+	gcraKeyPrefix   = "gcra:"
+	gcraBlockSuffix = ":block"
+	leaseKeyPrefix  = "lease:"
+)
+
+// prefixedKey põe o prefixo do namespace na frente da chave, sem prefixo a chave é a legada
+func prefixedKey(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + ":" + key
+}
+
+// MigrateLegacyKeys move para o KeyPrefix as chaves gravadas sem ele, de todas as strategies
+// e a lista de acesso, mantendo o TTL. rename converte o id legado no id com namespace.
+// Se a chave nova já existe ela é mais recente e fica, a legada só é apagada.
+// Retorna quantas chaves foram movidas.
+func (r *RedisLimitRepository) MigrateLegacyKeys(ctx context.Context, rename func(id string) string) (int, error) {
+	if r.KeyPrefix == "" {
+		return 0, errors.New("key prefix is required to migrate legacy keys")
+	}
+
+	migrated := 0
+	var cursor uint64
+	for {
+		keys, next, err := scanKeys(ctx, r.Rdb, cursor, "*", 100, "")
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, key := range keys {
+			if strings.HasPrefix(key, r.key("")) {
+				continue
+			}
+
+			moved, err := r.migrateLegacyKey(ctx, key, rename)
+			if err != nil {
+				return migrated, err
+			}
+
+			if moved {
+				migrated++
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return migrated, nil
+		}
+	}
+}
+
+// migrateLegacyKey reconhece a chave pelo prefixo da strategy e pelo tipo, o que não for do
+// rate limiter fica onde está
+func (r *RedisLimitRepository) migrateLegacyKey(ctx context.Context, key string, rename func(id string) string) (bool, error) {
+	keyType, err := r.Rdb.Type(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case key == accessListKey && keyType == "set":
+		// As entradas se somam às que já estiverem no namespace. Sem SUNIONSTORE, as duas
+		// chaves podem estar em slots diferentes do Cluster.
+		members, err := r.Rdb.SMembers(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		if len(members) > 0 {
+			if err := r.Rdb.SAdd(ctx, r.key(accessListKey), members).Err(); err != nil {
+				return false, err
+			}
+		}
+		return true, r.Rdb.Del(ctx, key).Err()
+	case strings.HasPrefix(key, atomicKeyPrefix) && keyType == "zset":
+		id := strings.TrimSuffix(strings.TrimPrefix(key, atomicKeyPrefix), atomicLogSuffix)
+		return r.moveKey(ctx, key, r.key(atomicKeyPrefix+rename(id)+atomicLogSuffix), keyType)
+	case strings.HasPrefix(key, atomicKeyPrefix) && keyType == "hash":
+		return r.moveKey(ctx, key, r.key(atomicKeyPrefix+rename(strings.TrimPrefix(key, atomicKeyPrefix))), keyType)
+	case strings.HasPrefix(key, gcraKeyPrefix) && keyType == "hash":
+		id := strings.TrimSuffix(strings.TrimPrefix(key, gcraKeyPrefix), gcraBlockSuffix)
+		return r.moveKey(ctx, key, r.key(gcraKeyPrefix+rename(id)+gcraBlockSuffix), keyType)
+	case strings.HasPrefix(key, gcraKeyPrefix) && keyType == "string":
+		return r.moveKey(ctx, key, r.key(gcraKeyPrefix+rename(strings.TrimPrefix(key, gcraKeyPrefix))), keyType)
+	case strings.HasPrefix(key, leaseKeyPrefix) && keyType == "hash":
+		return r.moveKey(ctx, key, r.key(leaseKeyPrefix+rename(strings.TrimPrefix(key, leaseKeyPrefix))), keyType)
+	case keyType == "hash":
+		// Um hash sem prefixo só é um limit se tiver os campos do RedisLimitData
+		isLimit, err := r.Rdb.HExists(ctx, key, "last_at").Result()
+		if err != nil || !isLimit {
+			return false, err
+		}
+
+		id := rename(key)
+		moved, err := r.moveKey(ctx, key, r.key(id), keyType)
+		if err != nil || !moved {
+			return moved, err
+		}
+
+		// O campo id vira o Limit.Id, que o LimitUseCase usa para gravar o cache de volta
+		return true, r.Rdb.HSet(ctx, r.key(id), "id", id).Err()
+	}
+
+	return false, nil
+}
+
+// moveKey copia o valor pelo tipo da chave, que ao contrário do RENAME funciona entre slots do
+// Cluster, e mantém o TTL
+func (r *RedisLimitRepository) moveKey(ctx context.Context, from string, to string, keyType string) (bool, error) {
+	exists, err := r.Rdb.Exists(ctx, to).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if exists == 1 {
+		return false, r.Rdb.Del(ctx, from).Err()
+	}
+
+	ttl, err := r.Rdb.PTTL(ctx, from).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if ttl == -2 {
+		// Expirou durante a migração
+		return false, nil
+	}
+
+	switch keyType {
+	case "string":
+		var value string
+		value, err = r.Rdb.Get(ctx, from).Result()
+		if err == nil {
+			err = r.Rdb.Set(ctx, to, value, 0).Err()
+		}
+	case "hash":
+		var fields map[string]string
+		fields, err = r.Rdb.HGetAll(ctx, from).Result()
+		if err == nil && len(fields) > 0 {
+			err = r.Rdb.HSet(ctx, to, fields).Err()
+		}
+	case "zset":
+		var members []redis.Z
+		members, err = r.Rdb.ZRangeWithScores(ctx, from, 0, -1).Result()
+		if err == nil && len(members) > 0 {
+			err = r.Rdb.ZAdd(ctx, to, members...).Err()
+		}
+	}
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if ttl > 0 {
+		if err := r.Rdb.PExpire(ctx, to, ttl).Err(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, r.Rdb.Del(ctx, from).Err()
+}
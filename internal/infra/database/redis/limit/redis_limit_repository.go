@@ -2,7 +2,7 @@ package limit
 
 import (
 	"context"
-	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,25 +11,35 @@ import (
 )
 
 type RedisLimitData struct {
-	Id      string `redis:"id"`
-	FreeAt  string `redis:"free_at"`
-	LastAt  string `redis:"last_at"`
-	Counter int32  `redis:"counter"`
+	Id          string  `redis:"id"`
+	FreeAt      string  `redis:"free_at"`
+	LastAt      string  `redis:"last_at"`
+	Counter     int32   `redis:"counter"`
+	Timestamps  string  `redis:"timestamps"`
+	Tokens      float64 `redis:"tokens"`
+	WindowStart string  `redis:"window_start"`
+	PrevCounter int32   `redis:"prev_counter"`
+	Offenses    int32   `redis:"offenses"`
+	OffenseAt   string  `redis:"offense_at"`
+	ExpiresAt   string  `redis:"expires_at"`
 }
 
+// KeyPrefix vai na frente de todas as chaves gravadas, vazio mantém o formato legado
 type RedisLimitRepository struct {
-	Rdb   *redis.Client
-	Mutex *sync.Mutex
+	Rdb       redis.UniversalClient
+	Mutex     *sync.Mutex
+	KeyPrefix string
 }
 
 func NewRedisLimitRepository(host string, port string) *RedisLimitRepository {
+	return NewRedisLimitRepositoryWithClient(redis.NewClient(NewRedisOptions(host, port)))
+}
+
+// NewRedisLimitRepositoryWithClient usa um client já criado, standalone, sentinel ou cluster,
+// que pode ser compartilhado entre os repositories
+func NewRedisLimitRepositoryWithClient(rdb redis.UniversalClient) *RedisLimitRepository {
 	return &RedisLimitRepository{
-		Rdb: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", host, port),
-			Password: "",
-			DB:       0,
-			Protocol: 2,
-		}),
+		Rdb:   rdb,
 		Mutex: &sync.Mutex{},
 	}
 }
@@ -40,11 +50,39 @@ func (r *RedisLimitRepository) toRedis(limit *limit_entity.Limit) (*RedisLimitDa
 		freeAtStr = limit.FreeAt.Format(time.RFC3339)
 	}
 
+	var windowStartStr string
+	if !limit.WindowStart.IsZero() {
+		windowStartStr = limit.WindowStart.Format(time.RFC3339Nano)
+	}
+
+	var offenseAtStr string
+	if !limit.OffenseAt.IsZero() {
+		offenseAtStr = limit.OffenseAt.Format(time.RFC3339Nano)
+	}
+
+	var expiresAtStr string
+	if !limit.ExpiresAt.IsZero() {
+		expiresAtStr = limit.ExpiresAt.Format(time.RFC3339Nano)
+	}
+
+	// LastAt e os timestamps precisam de precisão abaixo do segundo
+	timestamps := make([]string, len(limit.Timestamps))
+	for i, t := range limit.Timestamps {
+		timestamps[i] = t.Format(time.RFC3339Nano)
+	}
+
 	return &RedisLimitData{
-		Id:      limit.Id,
-		FreeAt:  freeAtStr,
-		LastAt:  limit.LastAt.Format(time.RFC3339),
-		Counter: limit.Counter,
+		Id:          limit.Id,
+		FreeAt:      freeAtStr,
+		LastAt:      limit.LastAt.Format(time.RFC3339Nano),
+		Counter:     limit.Counter,
+		Timestamps:  strings.Join(timestamps, ","),
+		Tokens:      limit.Tokens,
+		WindowStart: windowStartStr,
+		PrevCounter: limit.PrevCounter,
+		Offenses:    limit.Offenses,
+		OffenseAt:   offenseAtStr,
+		ExpiresAt:   expiresAtStr,
 	}, nil
 }
 
@@ -60,16 +98,58 @@ func (r *RedisLimitRepository) toDomain(redisLimit *RedisLimitData) (*limit_enti
 		freeAt = &t
 	}
 
-	lastAt, err := time.Parse(time.RFC3339, redisLimit.LastAt)
+	lastAt, err := time.Parse(time.RFC3339Nano, redisLimit.LastAt)
 	if err != nil {
 		return &limit_entity.Limit{}, err
 	}
 
+	var timestamps []time.Time
+	if redisLimit.Timestamps != "" {
+		for _, ts := range strings.Split(redisLimit.Timestamps, ",") {
+			t, err := time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return &limit_entity.Limit{}, err
+			}
+			timestamps = append(timestamps, t)
+		}
+	}
+
+	var windowStart time.Time
+	if redisLimit.WindowStart != "" {
+		windowStart, err = time.Parse(time.RFC3339Nano, redisLimit.WindowStart)
+		if err != nil {
+			return &limit_entity.Limit{}, err
+		}
+	}
+
+	var offenseAt time.Time
+	if redisLimit.OffenseAt != "" {
+		offenseAt, err = time.Parse(time.RFC3339Nano, redisLimit.OffenseAt)
+		if err != nil {
+			return &limit_entity.Limit{}, err
+		}
+	}
+
+	var expiresAt time.Time
+	if redisLimit.ExpiresAt != "" {
+		expiresAt, err = time.Parse(time.RFC3339Nano, redisLimit.ExpiresAt)
+		if err != nil {
+			return &limit_entity.Limit{}, err
+		}
+	}
+
 	return &limit_entity.Limit{
-		Id:      redisLimit.Id,
-		FreeAt:  freeAt,
-		LastAt:  lastAt,
-		Counter: redisLimit.Counter,
+		Id:          redisLimit.Id,
+		FreeAt:      freeAt,
+		LastAt:      lastAt,
+		Counter:     redisLimit.Counter,
+		Timestamps:  timestamps,
+		Tokens:      redisLimit.Tokens,
+		WindowStart: windowStart,
+		PrevCounter: redisLimit.PrevCounter,
+		Offenses:    redisLimit.Offenses,
+		OffenseAt:   offenseAt,
+		ExpiresAt:   expiresAt,
 	}, nil
 }
 
@@ -80,7 +160,7 @@ func (r *RedisLimitRepository) CreateLimit(ctx context.Context, limit *limit_ent
 		return err
 	}
 
-	_, err = r.Rdb.HSet(ctx, limit.Id, redisData).Result()
+	err = r.save(ctx, r.key(limit.Id), limit, redisData)
 
 	if err != nil {
 		println("REDIS: erro HSET")
@@ -91,19 +171,21 @@ func (r *RedisLimitRepository) CreateLimit(ctx context.Context, limit *limit_ent
 }
 
 func (r *RedisLimitRepository) GetLimitById(ctx context.Context, id string) (*limit_entity.Limit, error) {
-	exists, err := r.Rdb.Exists(ctx, id).Result()
+	// Um HGETALL só: entre um EXISTS e ele a chave poderia expirar
+	result := r.Rdb.HGetAll(ctx, r.key(id))
+	raw, err := result.Result()
 	if err != nil {
+		println("REDIS: hgetall")
+		println(err)
 		return nil, err
 	}
 
-	if exists == 0 {
+	if len(raw) == 0 {
 		return nil, nil
 	}
 
 	var redisData RedisLimitData
-	err = r.Rdb.HGetAll(ctx, id).Scan(&redisData)
-
-	if err != nil {
+	if err := result.Scan(&redisData); err != nil {
 		println("REDIS: hgetall")
 		println(err)
 		return nil, err
@@ -125,11 +207,64 @@ func (r *RedisLimitRepository) UpdateLimitById(ctx context.Context, id string, l
 		return err
 	}
 
-	_, err = r.Rdb.HSet(ctx, id, redisData).Result()
+	return r.save(ctx, r.key(id), limit, redisData)
+}
+
+// save grava o hash com o mesmo prazo do limit, para o Redis apagar sozinho as chaves que não
+// influenciam mais nenhuma decisão
+func (r *RedisLimitRepository) save(ctx context.Context, key string, limit *limit_entity.Limit, redisData *RedisLimitData) error {
+	if limit.Expired(time.Now()) {
+		return r.Rdb.Del(ctx, key).Err()
+	}
+
+	_, err := r.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, redisData)
+		if limit.ExpiresAt.IsZero() {
+			pipe.Persist(ctx, key)
+		} else {
+			pipe.PExpireAt(ctx, key, limit.ExpiresAt)
+		}
+		return nil
+	})
 
+	return err
+}
+
+// Prefixos das chaves das outras strategies, que dividem o mesmo banco com os limits
+var otherStrategyPrefixes = []string{atomicKeyPrefix, gcraKeyPrefix, leaseKeyPrefix}
+
+func (r *RedisLimitRepository) key(id string) string {
+	return prefixedKey(r.KeyPrefix, id)
+}
+
+func (r *RedisLimitRepository) DeleteLimitById(ctx context.Context, id string) error {
+	return r.Rdb.Del(ctx, r.key(id)).Err()
+}
+
+// ListLimitIds é um SCAN pelos hashes, então uma página pode vir vazia sem o fim ter chegado
+func (r *RedisLimitRepository) ListLimitIds(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	keys, next, err := scanKeys(ctx, r.Rdb, cursor, r.key("*"), count, "hash")
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	return nil
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, r.key(""))
+		if !hasAnyPrefix(id, otherStrategyPrefixes) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, next, nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,218 @@
+package limit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Modos de conexão com o Redis
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+// RedisConfig é a configuração da conexão com o Redis. URL, no formato redis:// ou rediss://,
+// substitui Host e Port e os demais campos, quando preenchidos, sobrescrevem o que veio nela.
+// Os arquivos de TLS ligam o TLS mesmo sem a flag. Sem Protocol a conexão continua em RESP2.
+// Em sentinel Addrs são os sentinels e em cluster os nós usados para descobrir os demais,
+// sem Addrs vale o endereço da URL ou Host e Port.
+type RedisConfig struct {
+	Mode             string
+	URL              string
+	Host             string
+	Port             string
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelUsername string
+	SentinelPassword string
+	DB               int
+	TLS              bool
+	TLSCAFile        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSServerName    string
+	PoolSize         int
+	MinIdleConns     int
+	DialTimeout      time.Duration
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	Protocol         int
+}
+
+// NewRedisOptions é a conexão usada pelos construtores com host e porta
+func NewRedisOptions(host string, port string) *redis.Options {
+	return &redis.Options{
+		Addr:     net.JoinHostPort(host, port),
+		Password: "",
+		DB:       0,
+		Protocol: 2,
+	}
+}
+
+// NewClient cria o client do modo configurado. O modo é explícito porque o
+// redis.NewUniversalClient escolheria o Cluster só pela quantidade de endereços.
+func (c RedisConfig) NewClient() (redis.UniversalClient, error) {
+	options, err := c.UniversalOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Mode {
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(options.Failover()), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return redis.NewClient(options.Simple()), nil
+	}
+}
+
+func (c RedisConfig) UniversalOptions() (*redis.UniversalOptions, error) {
+	base := NewRedisOptions(c.Host, c.Port)
+	if c.URL != "" {
+		parsed, err := redis.ParseURL(c.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		base = parsed
+		if base.Protocol == 0 {
+			base.Protocol = 2
+		}
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		IsClusterMode:    c.Mode == RedisModeCluster,
+		Username:         base.Username,
+		Password:         base.Password,
+		SentinelUsername: c.SentinelUsername,
+		SentinelPassword: c.SentinelPassword,
+		DB:               base.DB,
+		PoolSize:         base.PoolSize,
+		MinIdleConns:     base.MinIdleConns,
+		DialTimeout:      base.DialTimeout,
+		ReadTimeout:      base.ReadTimeout,
+		WriteTimeout:     base.WriteTimeout,
+		Protocol:         base.Protocol,
+		TLSConfig:        base.TLSConfig,
+	}
+
+	if len(options.Addrs) == 0 {
+		options.Addrs = []string{base.Addr}
+	}
+
+	if c.Username != "" {
+		options.Username = c.Username
+	}
+
+	if c.Password != "" {
+		options.Password = c.Password
+	}
+
+	if c.DB != 0 {
+		options.DB = c.DB
+	}
+
+	if c.PoolSize != 0 {
+		options.PoolSize = c.PoolSize
+	}
+
+	if c.MinIdleConns != 0 {
+		options.MinIdleConns = c.MinIdleConns
+	}
+
+	if c.DialTimeout != 0 {
+		options.DialTimeout = c.DialTimeout
+	}
+
+	if c.ReadTimeout != 0 {
+		options.ReadTimeout = c.ReadTimeout
+	}
+
+	if c.WriteTimeout != 0 {
+		options.WriteTimeout = c.WriteTimeout
+	}
+
+	if c.Protocol != 0 {
+		options.Protocol = c.Protocol
+	}
+
+	switch c.Mode {
+	case "", RedisModeStandalone:
+		if len(options.Addrs) > 1 {
+			return nil, errors.New("standalone mode takes a single address")
+		}
+	case RedisModeSentinel:
+		if options.MasterName == "" {
+			return nil, errors.New("sentinel mode requires a master name")
+		}
+	case RedisModeCluster:
+		if options.DB != 0 {
+			return nil, errors.New("cluster mode only supports DB 0")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s", c.Mode)
+	}
+
+	if options.TLSConfig != nil || c.TLS || c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSServerName != "" {
+		tlsConfig, err := c.tlsConfig(options.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+
+	return options, nil
+}
+
+// tlsConfig parte do que o rediss:// já configurou. Sem CA valem as do sistema e sem
+// TLSServerName o nome é o do endereço de cada conexão.
+func (c RedisConfig) tlsConfig(tlsConfig *tls.Config) (*tls.Config, error) {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	// O rediss:// usa o host da URL, que em sentinel e cluster é só um dos nós
+	if c.Mode != "" && c.Mode != RedisModeStandalone {
+		tlsConfig.ServerName = ""
+	}
+
+	if c.TLSServerName != "" {
+		tlsConfig.ServerName = c.TLSServerName
+	}
+
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,48 @@
+package limit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// penaltyScript são as funções da penalidade progressiva do limit_entity, incluídas nos
+// scripts que bloqueiam. Precisa vir depois de now estar definido.
+var penaltyScript = fmt.Sprintf(`
+local penalty_multipliers = {%s}
+
+-- Mesma lógica do limit_entity.OffenseLevel
+local function offense_level(offenses, offense_at, decay)
+	if decay <= 0 or offenses <= 0 or now - offense_at > decay then
+		return 0
+	end
+	return offenses
+end
+
+-- Mesma lógica do limit_entity.NextOffense
+local function next_offense(offenses, offense_at, decay)
+	if decay <= 0 then
+		return 0
+	end
+	return offense_level(offenses, offense_at, decay) + 1
+end
+
+-- Mesma lógica do limit_entity.PenaltyBlockTime
+local function penalty_block(block, offenses, max_block)
+	if offenses <= 1 then
+		return block
+	end
+	local multiplier = penalty_multipliers[math.min(offenses, #penalty_multipliers)]
+	return math.max(block, math.min(block * multiplier, max_block))
+end
+`, penaltyMultipliers())
+
+func penaltyMultipliers() string {
+	multipliers := make([]string, len(limit_entity.PenaltyMultipliers))
+	for i, multiplier := range limit_entity.PenaltyMultipliers {
+		multipliers[i] = fmt.Sprint(multiplier)
+	}
+
+	return strings.Join(multipliers, ", ")
+}
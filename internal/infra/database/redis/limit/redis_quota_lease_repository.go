@@ -0,0 +1,128 @@
+package limit
+
+import (
+	"context"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/redis/go-redis/v9"
+)
+
+// O hash guarda o total concedido na janela atual ou, quando bloqueado, apenas free_at.
+// Nos dois casos também guarda o nível da penalidade progressiva.
+// Os tempos ficam em microssegundos e o relógio é o do Redis.
+// ARGV traz max_reqs, window, lease_size, block, max_block e penalty_decay, nessa ordem.
+// Retorna {granted, window_start_us, window_end_us, free_at_us, available, offense_level}.
+var acquireQuotaScript = redis.NewScript(`
+local now_parts = redis.call('TIME')
+local now = tonumber(now_parts[1]) * 1000000 + tonumber(now_parts[2])
+` + penaltyScript + `
+local max_reqs = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local lease_size = tonumber(ARGV[3])
+local block = tonumber(ARGV[4])
+local max_block = tonumber(ARGV[5])
+local penalty_decay = tonumber(ARGV[6])
+
+local state = redis.call('HMGET', KEYS[1], 'free_at', 'offenses', 'offense_at')
+local free_at = tonumber(state[1])
+local offenses = tonumber(state[2]) or 0
+local offense_at = tonumber(state[3]) or 0
+local level = offense_level(offenses, offense_at, penalty_decay)
+
+-- A chave vive até o fim da janela ou da penalidade, o que vier depois
+local function expire_at(until_at)
+	if level > 0 then
+		until_at = math.max(until_at, offense_at + penalty_decay)
+	end
+	redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil((until_at - now) / 1000)))
+end
+
+if free_at then
+	if free_at >= now then
+		return {0, 0, 0, free_at, 0, level}
+	end
+
+	-- Já passou o tempo de bloqueio, começa do zero, menos a penalidade
+	redis.call('HDEL', KEYS[1], 'free_at')
+end
+
+local window_start = now - (now % window)
+local granted_total = 0
+if tonumber(redis.call('HGET', KEYS[1], 'window_start')) == window_start then
+	granted_total = tonumber(redis.call('HGET', KEYS[1], 'granted'))
+end
+
+local granted = math.min(lease_size, max_reqs - granted_total)
+if granted <= 0 then
+	if block > 0 then
+		-- Esgotou a janela, bloqueia a chave para todas as instâncias pelo tempo do nível
+		offenses = next_offense(offenses, offense_at, penalty_decay)
+		free_at = now + penalty_block(block, offenses, max_block)
+		if offenses > 0 then
+			offense_at = free_at
+		end
+		level = offenses
+
+		redis.call('DEL', KEYS[1])
+		redis.call('HSET', KEYS[1], 'free_at', free_at, 'offenses', offenses, 'offense_at', offense_at)
+		expire_at(free_at)
+		return {0, 0, 0, free_at, 0, level}
+	end
+
+	return {0, window_start, window_start + window, 0, 0, level}
+end
+
+redis.call('HSET', KEYS[1], 'window_start', window_start, 'granted', granted_total + granted)
+expire_at(window_start + window)
+
+return {granted, window_start, window_start + window, 0, max_reqs - granted_total - granted, level}
+`)
+
+// Só devolve se a chave não estiver bloqueada e a janela ainda for a da fatia.
+// ARGV traz window_start e unused.
+var releaseQuotaScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], 'free_at') == 1 then
+	return 0
+end
+
+if tonumber(redis.call('HGET', KEYS[1], 'window_start')) ~= tonumber(ARGV[1]) then
+	return 0
+end
+
+local granted = tonumber(redis.call('HGET', KEYS[1], 'granted'))
+redis.call('HSET', KEYS[1], 'granted', math.max(0, granted - tonumber(ARGV[2])))
+
+return 1
+`)
+
+func (r *RedisLimitRepository) AcquireQuota(ctx context.Context, rule limit_entity.QuotaLeaseRule) (*limit_entity.QuotaLease, error) {
+	result, err := acquireQuotaScript.Run(ctx, r.Rdb, []string{r.key(leaseKeyPrefix + rule.Key)},
+		rule.MaxReqs,
+		rule.Window.Microseconds(),
+		rule.LeaseSize,
+		rule.BlockTime.Microseconds(),
+		rule.MaxBlockTime.Microseconds(),
+		rule.PenaltyDecay.Microseconds(),
+	).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if result[3] > 0 {
+		freeAt := time.UnixMicro(result[3])
+		return &limit_entity.QuotaLease{FreeAt: &freeAt, OffenseLevel: int32(result[5])}, nil
+	}
+
+	return &limit_entity.QuotaLease{
+		Granted:      int32(result[0]),
+		Available:    int32(result[4]),
+		WindowStart:  time.UnixMicro(result[1]),
+		WindowEnd:    time.UnixMicro(result[2]),
+		OffenseLevel: int32(result[5]),
+	}, nil
+}
+
+func (r *RedisLimitRepository) ReleaseQuota(ctx context.Context, key string, windowStart time.Time, unused int32) error {
+	return releaseQuotaScript.Run(ctx, r.Rdb, []string{r.key(leaseKeyPrefix + key)}, windowStart.UnixMicro(), unused).Err()
+}
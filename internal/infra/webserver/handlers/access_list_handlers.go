@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+type AccessEntryDTO struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+}
+
+type AccessListDTO struct {
+	Static  []AccessEntryDTO `json:"static"`
+	Dynamic []AccessEntryDTO `json:"dynamic"`
+}
+
+type AccessListHandler struct {
+	AccessListUseCase *usecase.AccessListUseCase
+}
+
+func NewAccessListHandler(accessListUseCase *usecase.AccessListUseCase) *AccessListHandler {
+	return &AccessListHandler{
+		AccessListUseCase: accessListUseCase,
+	}
+}
+
+// ListAccessEntries devolve as entradas da configuração (static) e as incluídas pela API (dynamic)
+func (h *AccessListHandler) ListAccessEntries(w http.ResponseWriter, r *http.Request) {
+	output, err := h.AccessListUseCase.ListEntries(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AccessListDTO{
+		Static:  accessEntryDTOs(output.Static),
+		Dynamic: accessEntryDTOs(output.Dynamic),
+	})
+}
+
+func (h *AccessListHandler) AddAccessEntry(w http.ResponseWriter, r *http.Request) {
+	var payload AccessEntryDTO
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := h.AccessListUseCase.AddEntry(r.Context(), limit_entity.AccessEntry(payload))
+	if err != nil {
+		writeAccessListError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveAccessEntry recebe a entrada pela query, ex: ?action=deny&kind=cidr&value=10.0.0.0/8
+func (h *AccessListHandler) RemoveAccessEntry(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	err := h.AccessListUseCase.RemoveEntry(r.Context(), limit_entity.AccessEntry{
+		Action: query.Get("action"),
+		Kind:   query.Get("kind"),
+		Value:  query.Get("value"),
+	})
+	if err != nil {
+		writeAccessListError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func accessEntryDTOs(entries []limit_entity.AccessEntry) []AccessEntryDTO {
+	dtos := make([]AccessEntryDTO, len(entries))
+	for i, entry := range entries {
+		dtos[i] = AccessEntryDTO(entry)
+	}
+
+	return dtos
+}
+
+func writeAccessListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, usecase.ErrInvalidAccessEntry) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{Message: err.Error()})
+}
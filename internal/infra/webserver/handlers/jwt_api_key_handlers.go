@@ -41,12 +41,33 @@ func (h *JWTAPIKeyHandler) CreateJWTAPIKey(w http.ResponseWriter, r *http.Reques
 	jwt := r.Context().Value("jwt").(*jwtauth.JWTAuth)
 	jwtExpiresIn := r.Context().Value("jwtExpiresIn").(int)
 
-	_, tokenString, _ := jwt.Encode(map[string]interface{}{
-		"sub":            apiTokenConfig.ID.String(),
-		"exp":            time.Now().Add(time.Duration(jwtExpiresIn) * time.Second).Unix(),
-		"maxReqsBySec":   apiTokenConfig.MaxReqsBySec,
-		"blockTimeBySec": apiTokenConfig.BlockTimeBySec,
-	})
+	claims := map[string]interface{}{
+		"sub":               apiTokenConfig.ID.String(),
+		"exp":               time.Now().Add(time.Duration(jwtExpiresIn) * time.Second).Unix(),
+		"maxReqs":           apiTokenConfig.MaxReqs,
+		"windowBySec":       apiTokenConfig.WindowBySec,
+		"blockTimeBySec":    apiTokenConfig.BlockTimeBySec,
+		"burst":             apiTokenConfig.Burst,
+		"algorithm":         string(apiTokenConfig.Algorithm),
+		"blockPolicy":       string(apiTokenConfig.BlockPolicy),
+		"penaltyDecayBySec": apiTokenConfig.PenaltyDecayBySec,
+	}
+
+	if len(apiTokenConfig.Tiers) > 0 {
+		tiers := make([]map[string]interface{}, len(apiTokenConfig.Tiers))
+		for i, tier := range apiTokenConfig.Tiers {
+			tiers[i] = map[string]interface{}{
+				"name":           tier.Name,
+				"maxReqs":        tier.MaxReqs,
+				"windowBySec":    tier.WindowBySec,
+				"blockTimeBySec": tier.BlockTimeBySec,
+				"burst":          tier.Burst,
+			}
+		}
+		claims["tiers"] = tiers
+	}
+
+	_, tokenString, _ := jwt.Encode(claims)
 
 	accessToken :=
 		struct {
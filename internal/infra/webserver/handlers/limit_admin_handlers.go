@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+// LimitAdminHandler recebe o id da chave pela query, os ids podem ter barras, ex:
+// route:GET /rate-limit/orders|203.0.113.7
+type LimitAdminHandler struct {
+	LimitAdminUseCase *usecase.LimitAdminUseCase
+}
+
+func NewLimitAdminHandler(limitAdminUseCase *usecase.LimitAdminUseCase) *LimitAdminHandler {
+	return &LimitAdminHandler{
+		LimitAdminUseCase: limitAdminUseCase,
+	}
+}
+
+// ListLimits percorre os ids: ?cursor=0&count=100, continua com o cursor devolvido até ele ser zero
+func (h *LimitAdminHandler) ListLimits(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var cursor uint64
+	var count int64 = 100
+	var err error
+
+	if value := query.Get("cursor"); value != "" {
+		if cursor, err = strconv.ParseUint(value, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid cursor"))
+			return
+		}
+	}
+
+	if value := query.Get("count"); value != "" {
+		if count, err = strconv.ParseInt(value, 10, 64); err != nil || count <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid count"))
+			return
+		}
+	}
+
+	output, err := h.LimitAdminUseCase.ListLimits(r.Context(), cursor, count)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (h *LimitAdminHandler) GetLimit(w http.ResponseWriter, r *http.Request) {
+	id, ok := limitId(w, r)
+	if !ok {
+		return
+	}
+
+	output, err := h.LimitAdminUseCase.GetLimit(r.Context(), id)
+	if err != nil {
+		writeLimitAdminError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (h *LimitAdminHandler) ResetLimit(w http.ResponseWriter, r *http.Request) {
+	id, ok := limitId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.LimitAdminUseCase.ResetLimit(r.Context(), id); err != nil {
+		writeLimitAdminError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *LimitAdminHandler) UnblockLimit(w http.ResponseWriter, r *http.Request) {
+	id, ok := limitId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.LimitAdminUseCase.UnblockLimit(r.Context(), id); err != nil {
+		writeLimitAdminError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BlockLimit recebe a duração no formato do Go, ex: ?id=203.0.113.7&duration=30m
+func (h *LimitAdminHandler) BlockLimit(w http.ResponseWriter, r *http.Request) {
+	id, ok := limitId(w, r)
+	if !ok {
+		return
+	}
+
+	duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil || duration <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid duration"))
+		return
+	}
+
+	if err := h.LimitAdminUseCase.BlockLimit(r.Context(), id, duration); err != nil {
+		writeLimitAdminError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func limitId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("id is required"))
+		return "", false
+	}
+
+	return id, true
+}
+
+func writeLimitAdminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, usecase.ErrLimitNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, err)
+}
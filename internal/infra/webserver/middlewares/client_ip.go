@@ -0,0 +1,231 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers de proxy aceitos para descobrir o IP do cliente
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// Precedência padrão: o Forwarded (RFC 7239) é o mais completo, o X-Real-IP o mais pobre
+var DefaultClientIPHeaders = []string{HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP}
+
+// ClientIPResolver descobre o IP do cliente. Os headers de proxy só são lidos quando a
+// conexão vem de um proxy confiável, de qualquer outro peer eles podem ser forjados.
+type ClientIPResolver struct {
+	trustedProxies []*net.IPNet
+	headers        []string
+}
+
+// NewClientIPResolver aceita CIDRs ou IPs soltos como proxies confiáveis. Sem headers
+// vale DefaultClientIPHeaders, na ordem em que estão.
+func NewClientIPResolver(trustedProxies []string, headers []string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{
+		trustedProxies: make([]*net.IPNet, 0, len(trustedProxies)),
+		headers:        make([]string, 0, len(headers)),
+	}
+
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		ipNet, err := parseIPNet(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, ipNet)
+	}
+
+	if len(headers) == 0 {
+		headers = DefaultClientIPHeaders
+	}
+
+	for _, header := range headers {
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(header))
+		switch canonical {
+		case http.CanonicalHeaderKey(HeaderForwarded),
+			http.CanonicalHeaderKey(HeaderXForwardedFor),
+			http.CanonicalHeaderKey(HeaderXRealIP):
+			resolver.headers = append(resolver.headers, canonical)
+		default:
+			return nil, fmt.Errorf("unsupported client ip header: %s", header)
+		}
+	}
+
+	return resolver, nil
+}
+
+// ClientIP devolve o IP do cliente. Se o peer não for confiável é ele mesmo; senão o
+// primeiro header presente, percorrido da direita para a esquerda, dá o primeiro
+// endereço que não é de um proxy confiável.
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !c.isTrusted(peerIP) {
+		return peer
+	}
+
+	for _, header := range c.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		var chain []net.IP
+		var ok bool
+		switch header {
+		case http.CanonicalHeaderKey(HeaderForwarded):
+			chain, ok = parseForwarded(values)
+		case http.CanonicalHeaderKey(HeaderXForwardedFor):
+			chain, ok = parseXForwardedFor(values)
+		default:
+			chain, ok = parseXRealIP(values)
+		}
+
+		// Header mal formado não é confiável, tenta o próximo
+		if !ok || len(chain) == 0 {
+			continue
+		}
+
+		return c.rightmostUntrusted(chain).String()
+	}
+
+	return peer
+}
+
+func (c *ClientIPResolver) isTrusted(ip net.IP) bool {
+	return containsIP(c.trustedProxies, ip)
+}
+
+// parseIPNet aceita um CIDR ou um IP solto, que vira uma rede com só ele
+func parseIPNet(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip: %s", value)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return ipNet, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cada proxy confiável acrescenta à direita quem falou com ele, então o primeiro não
+// confiável vindo da direita é o cliente. Se todos forem confiáveis vale o mais à esquerda.
+func (c *ClientIPResolver) rightmostUntrusted(chain []net.IP) net.IP {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !c.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+
+	return chain[0]
+}
+
+// parseForwarded lê o parâmetro for de cada elemento, ex: for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"
+func parseForwarded(values []string) ([]net.IP, bool) {
+	var chain []net.IP
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			found := false
+
+			for _, pair := range strings.Split(element, ";") {
+				key, node, hasValue := strings.Cut(strings.TrimSpace(pair), "=")
+				if !hasValue || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				ip := parseNode(strings.Trim(node, `"`))
+				if ip == nil {
+					return nil, false
+				}
+
+				chain = append(chain, ip)
+				found = true
+			}
+
+			if !found {
+				return nil, false
+			}
+		}
+	}
+
+	return chain, true
+}
+
+func parseXForwardedFor(values []string) ([]net.IP, bool) {
+	var chain []net.IP
+
+	for _, value := range values {
+		for _, node := range strings.Split(value, ",") {
+			ip := parseNode(strings.TrimSpace(node))
+			if ip == nil {
+				return nil, false
+			}
+
+			chain = append(chain, ip)
+		}
+	}
+
+	return chain, true
+}
+
+// O X-Real-IP é escrito inteiro pelo proxy, só pode ter um endereço
+func parseXRealIP(values []string) ([]net.IP, bool) {
+	if len(values) != 1 {
+		return nil, false
+	}
+
+	ip := parseNode(strings.TrimSpace(values[0]))
+	if ip == nil {
+		return nil, false
+	}
+
+	return []net.IP{ip}, true
+}
+
+// parseNode aceita IPv4, IPv6, os dois com porta e IPv6 entre colchetes.
+// Identificadores ofuscados e "unknown" do Forwarded não são IPs e devolvem nil.
+func parseNode(node string) net.IP {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
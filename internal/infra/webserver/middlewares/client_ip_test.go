@@ -0,0 +1,197 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPResolver_ClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		headers        []string
+		remoteAddr     string
+		requestHeaders map[string][]string
+		expected       string
+	}{
+		{
+			name:       "without trusted proxies uses the peer",
+			remoteAddr: "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"1.1.1.1"},
+			},
+			expected: "10.0.0.1",
+		},
+		{
+			name:           "untrusted peer cannot spoof headers",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "8.8.8.8:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded":       {"for=1.1.1.1"},
+				"X-Forwarded-For": {"1.1.1.1"},
+				"X-Real-Ip":       {"1.1.1.1"},
+			},
+			expected: "8.8.8.8",
+		},
+		{
+			name:           "trusted peer without headers uses the peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			expected:       "10.0.0.1",
+		},
+		{
+			name:           "x-forwarded-for uses the right-most untrusted address",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"6.6.6.6, 2.2.2.2, 10.0.0.2"},
+			},
+			expected: "2.2.2.2",
+		},
+		{
+			name:           "x-forwarded-for split across header lines",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"6.6.6.6", "2.2.2.2, 10.0.0.2"},
+			},
+			expected: "2.2.2.2",
+		},
+		{
+			name:           "x-forwarded-for with only trusted addresses uses the left-most",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"},
+			},
+			expected: "10.0.0.3",
+		},
+		{
+			name:           "forwarded takes precedence over x-forwarded-for",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded":       {"for=3.3.3.3;proto=https, for=10.0.0.2"},
+				"X-Forwarded-For": {"2.2.2.2"},
+			},
+			expected: "3.3.3.3",
+		},
+		{
+			name:           "forwarded with quoted ipv6 and port",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded": {`for="[2001:db8:cafe::17]:4711"`},
+			},
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:           "forwarded with ipv4 and port",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded": {`For="192.0.2.43:47011"`},
+			},
+			expected: "192.0.2.43",
+		},
+		{
+			name:           "forwarded with unknown node falls back to the next header",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded":       {"for=unknown"},
+				"X-Forwarded-For": {"2.2.2.2"},
+			},
+			expected: "2.2.2.2",
+		},
+		{
+			name:           "forwarded element without for falls back to the next header",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded": {"proto=https"},
+				"X-Real-Ip": {"4.4.4.4"},
+			},
+			expected: "4.4.4.4",
+		},
+		{
+			name:           "x-real-ip",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Real-Ip": {"4.4.4.4"},
+			},
+			expected: "4.4.4.4",
+		},
+		{
+			name:           "x-real-ip with more than one value is ignored",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Real-Ip": {"4.4.4.4", "5.5.5.5"},
+			},
+			expected: "10.0.0.1",
+		},
+		{
+			name:           "malformed x-forwarded-for falls back to the peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"not-an-ip"},
+			},
+			expected: "10.0.0.1",
+		},
+		{
+			name:           "custom precedence only reads the configured headers",
+			trustedProxies: []string{"10.0.0.0/8"},
+			headers:        []string{"x-real-ip"},
+			remoteAddr:     "10.0.0.1:1234",
+			requestHeaders: map[string][]string{
+				"Forwarded":       {"for=3.3.3.3"},
+				"X-Forwarded-For": {"2.2.2.2"},
+				"X-Real-Ip":       {"4.4.4.4"},
+			},
+			expected: "4.4.4.4",
+		},
+		{
+			name:           "trusted ipv6 peer given as a single ip",
+			trustedProxies: []string{"::1"},
+			remoteAddr:     "[::1]:1234",
+			requestHeaders: map[string][]string{
+				"X-Forwarded-For": {"2001:db8::1"},
+			},
+			expected: "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := NewClientIPResolver(tt.trustedProxies, tt.headers)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for header, values := range tt.requestHeaders {
+				for _, value := range values {
+					r.Header.Add(header, value)
+				}
+			}
+
+			assert.Equal(t, tt.expected, resolver.ClientIP(r))
+		})
+	}
+}
+
+func TestNewClientIPResolver_Should_return_error_when_config_is_invalid(t *testing.T) {
+	_, err := NewClientIPResolver([]string{"10.0.0.0/33"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewClientIPResolver([]string{"not-an-ip"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewClientIPResolver(nil, []string{"X-Client-IP"})
+	assert.Error(t, err)
+}
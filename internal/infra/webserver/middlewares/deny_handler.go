@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+// Tipo da chave que foi limitada
+const (
+	KeyTypeIP    = "ip"
+	KeyTypeToken = "token"
+)
+
+type keyTypeContextKey struct{}
+
+// LimitKeyType devolve o tipo da chave limitada, disponível para o DenyHandler
+func LimitKeyType(ctx context.Context) string {
+	keyType, _ := ctx.Value(keyTypeContextKey{}).(string)
+	return keyType
+}
+
+// DenyHandler escreve a resposta de uma requisição negada, com status, content type e
+// corpo que quiser. Os headers RateLimit e Retry-After já estão escritos quando é chamado.
+type DenyHandler func(w http.ResponseWriter, r *http.Request, result usecase.LimitOutputDTO)
+
+// RateLimitProblem é o corpo application/problem+json (RFC 9457) da resposta padrão
+type RateLimitProblem struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	Status       int    `json:"status"`
+	Detail       string `json:"detail"`
+	RetryAfter   int64  `json:"retry_after"`
+	KeyType      string `json:"key_type"`
+	Tier         string `json:"tier,omitempty"`
+	OffenseLevel int32  `json:"offense_level,omitempty"`
+}
+
+// DefaultDenyHandler responde 429 com um problem+json
+func DefaultDenyHandler(w http.ResponseWriter, r *http.Request, result usecase.LimitOutputDTO) {
+	problem := RateLimitProblem{
+		Type:         "about:blank",
+		Title:        http.StatusText(http.StatusTooManyRequests),
+		Status:       http.StatusTooManyRequests,
+		Detail:       "you have reached the maximum number of requests or actions allowed within a certain time frame",
+		RetryAfter:   retryAfterSeconds(result),
+		KeyType:      LimitKeyType(r.Context()),
+		Tier:         result.Tier,
+		OffenseLevel: result.OffenseLevel,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// AccessProblem é o corpo problem+json da resposta a uma requisição recusada pelas listas de acesso
+type AccessProblem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// AccessDeniedHandler responde 403 com um problem+json, sem headers RateLimit porque a
+// requisição nem chega ao limite
+func AccessDeniedHandler(w http.ResponseWriter, r *http.Request) {
+	problem := AccessProblem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusForbidden),
+		Status: http.StatusForbidden,
+		Detail: "the client address or api key is not allowed to access this resource",
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+// resultLimiter devolve sempre o mesmo resultado
+type resultLimiter struct {
+	result usecase.LimitOutputDTO
+}
+
+func (l *resultLimiter) Execute(ctx context.Context, input usecase.LimitInputDTO) (usecase.LimitOutputDTO, error) {
+	return l.result, nil
+}
+
+func TestDefaultDenyHandler_Should_answer_a_problem_json(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		result   usecase.LimitOutputDTO
+		expected RateLimitProblem
+	}{
+		{
+			name:   "ip key",
+			result: usecase.LimitOutputDTO{Pass: false, Limit: 5, RetryAfter: 1500 * time.Millisecond},
+			expected: RateLimitProblem{
+				RetryAfter: 2,
+				KeyType:    KeyTypeIP,
+			},
+		},
+		{
+			name:   "retry after falls back to the reset",
+			result: usecase.LimitOutputDTO{Pass: false, Limit: 5, Reset: 3 * time.Second},
+			expected: RateLimitProblem{
+				RetryAfter: 3,
+				KeyType:    KeyTypeIP,
+			},
+		},
+		{
+			name:   "header key with tier and offense level",
+			header: "acme",
+			result: usecase.LimitOutputDTO{Pass: false, Limit: 100, RetryAfter: time.Minute, Tier: "minute", OffenseLevel: 2},
+			expected: RateLimitProblem{
+				RetryAfter:   60,
+				KeyType:      "tenant",
+				Tier:         "minute",
+				OffenseLevel: 2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := newTestMiddleware(&rateLimitRules{
+				extractors: []KeyExtractor{
+					NewHeaderKeyExtractor("tenant", "X-Tenant-ID", KeyLimits{MaxReqs: 100}),
+					NewIPKeyExtractor(KeyLimits{MaxReqs: 5}, nil, nil),
+				},
+			}, &resultLimiter{result: tt.result})
+			handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+
+			var problem RateLimitProblem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+
+			assert.Equal(t, "about:blank", problem.Type)
+			assert.Equal(t, "Too Many Requests", problem.Title)
+			assert.Equal(t, http.StatusTooManyRequests, problem.Status)
+			assert.NotEmpty(t, problem.Detail)
+			assert.Equal(t, tt.expected.RetryAfter, problem.RetryAfter)
+			assert.Equal(t, tt.expected.KeyType, problem.KeyType)
+			assert.Equal(t, tt.expected.Tier, problem.Tier)
+			assert.Equal(t, tt.expected.OffenseLevel, problem.OffenseLevel)
+		})
+	}
+}
+
+func TestDefaultDenyHandler_Should_omit_empty_tier_and_offense_level(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	DefaultDenyHandler(recorder, httptest.NewRequest("GET", "/", nil), usecase.LimitOutputDTO{Pass: false, RetryAfter: time.Second})
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+
+	assert.NotContains(t, body, "tier")
+	assert.NotContains(t, body, "offense_level")
+	assert.Equal(t, float64(1), body["retry_after"])
+	assert.Equal(t, "", body["key_type"])
+}
+
+func TestRateLimitMiddlewareBuilder_WithDenyHandler_Should_replace_the_default(t *testing.T) {
+	var received usecase.LimitOutputDTO
+	var keyType string
+
+	middleware := NewRateLimitMiddlewareBuilder().
+		WithRedis("localhost", "6379").
+		WithRateLimitByIP(5, 5).
+		WithDenyHandler(func(w http.ResponseWriter, r *http.Request, result usecase.LimitOutputDTO) {
+			received = result
+			keyType = LimitKeyType(r.Context())
+
+			// Os headers do limite já chegam escritos
+			assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("slow down"))
+		}).
+		BuildMiddleware()
+
+	result := usecase.LimitOutputDTO{Pass: false, Limit: 5, RetryAfter: 2 * time.Second, Tier: "second"}
+	middleware.limitUseCase = &resultLimiter{result: result}
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "text/plain", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "slow down", recorder.Body.String())
+	assert.Equal(t, "second", recorder.Header().Get("X-RateLimit-Tier"))
+	assert.Equal(t, result, received)
+	assert.Equal(t, KeyTypeIP, keyType)
+
+	// A requisição que passa não chega ao DenyHandler
+	received = usecase.LimitOutputDTO{}
+	middleware.limitUseCase = &resultLimiter{result: usecase.LimitOutputDTO{Pass: true, Limit: 5, Remaining: 4}}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, usecase.LimitOutputDTO{}, received)
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Por padrão o IPv4 é limitado por endereço e o IPv6 pelo /64, que é o que um cliente controla
+const (
+	DefaultIPv4Prefix = 32
+	DefaultIPv6Prefix = 64
+)
+
+// IPPrefixAggregator junta na mesma chave os endereços da mesma rede. Um cliente IPv6
+// costuma controlar um /64 inteiro, limitar por endereço exato não adianta.
+type IPPrefixAggregator struct {
+	v4Prefix int
+	v6Prefix int
+}
+
+func NewIPPrefixAggregator(v4Prefix int, v6Prefix int) (*IPPrefixAggregator, error) {
+	if v4Prefix < 0 || v4Prefix > 32 {
+		return nil, fmt.Errorf("invalid ipv4 prefix length: %d", v4Prefix)
+	}
+
+	if v6Prefix < 0 || v6Prefix > 128 {
+		return nil, fmt.Errorf("invalid ipv6 prefix length: %d", v6Prefix)
+	}
+
+	return &IPPrefixAggregator{
+		v4Prefix: v4Prefix,
+		v6Prefix: v6Prefix,
+	}, nil
+}
+
+// Key devolve a rede do endereço em notação CIDR, ou o próprio endereço quando o prefixo
+// é o tamanho inteiro. IPv4 mapeado em IPv6 conta como IPv4. O que não for IP volta intacto.
+func (a *IPPrefixAggregator) Key(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	addr = addr.Unmap().WithZone("")
+
+	bits := a.v6Prefix
+	if addr.Is4() {
+		bits = a.v4Prefix
+	}
+
+	if bits == addr.BitLen() {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+
+	return prefix.String()
+}
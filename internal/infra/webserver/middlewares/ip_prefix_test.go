@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPPrefixAggregator_Key(t *testing.T) {
+	tests := []struct {
+		name     string
+		v4Prefix int
+		v6Prefix int
+		ip       string
+		expected string
+	}{
+		{name: "ipv4 without aggregation", v4Prefix: 32, v6Prefix: 128, ip: "203.0.113.7", expected: "203.0.113.7"},
+		{name: "ipv4 to /24", v4Prefix: 24, v6Prefix: 64, ip: "203.0.113.7", expected: "203.0.113.0/24"},
+		{name: "ipv4 to /16", v4Prefix: 16, v6Prefix: 64, ip: "203.0.113.7", expected: "203.0.0.0/16"},
+		{name: "ipv4 to /0", v4Prefix: 0, v6Prefix: 64, ip: "203.0.113.7", expected: "0.0.0.0/0"},
+		{name: "ipv6 without aggregation", v4Prefix: 32, v6Prefix: 128, ip: "2001:db8:1:2:3:4:5:6", expected: "2001:db8:1:2:3:4:5:6"},
+		{name: "ipv6 to /64", v4Prefix: 32, v6Prefix: 64, ip: "2001:db8:1:2:3:4:5:6", expected: "2001:db8:1:2::/64"},
+		{name: "ipv6 in the same /64 shares the key", v4Prefix: 32, v6Prefix: 64, ip: "2001:db8:1:2:ffff::1", expected: "2001:db8:1:2::/64"},
+		{name: "ipv6 to /48", v4Prefix: 32, v6Prefix: 48, ip: "2001:db8:1:2:3:4:5:6", expected: "2001:db8:1::/48"},
+		{name: "ipv6 with zone", v4Prefix: 32, v6Prefix: 64, ip: "fe80::1:2%eth0", expected: "fe80::/64"},
+		{name: "ipv6 loopback", v4Prefix: 32, v6Prefix: 64, ip: "::1", expected: "::/64"},
+		{name: "v4-mapped-v6 uses the ipv4 prefix", v4Prefix: 24, v6Prefix: 64, ip: "::ffff:203.0.113.7", expected: "203.0.113.0/24"},
+		{name: "v4-mapped-v6 without aggregation is plain ipv4", v4Prefix: 32, v6Prefix: 64, ip: "::ffff:203.0.113.7", expected: "203.0.113.7"},
+		{name: "not an ip is kept", v4Prefix: 24, v6Prefix: 64, ip: "@", expected: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator, err := NewIPPrefixAggregator(tt.v4Prefix, tt.v6Prefix)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, aggregator.Key(tt.ip))
+		})
+	}
+}
+
+func TestNewIPPrefixAggregator_Should_return_error_when_prefix_is_out_of_range(t *testing.T) {
+	_, err := NewIPPrefixAggregator(33, 64)
+	assert.Error(t, err)
+
+	_, err = NewIPPrefixAggregator(24, 129)
+	assert.Error(t, err)
+
+	_, err = NewIPPrefixAggregator(-1, 64)
+	assert.Error(t, err)
+}
+
+func TestRateLimitMiddlewareBuilder_Should_aggregate_ipv6_by_64_by_default(t *testing.T) {
+	middleware := NewRateLimitMiddlewareBuilder().
+		WithRedis("localhost", "6379").
+		WithRateLimitByIP(5, 5).
+		BuildMiddleware()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:1234"
+	input, keyType, ok := middleware.rules.Load().extract(r)
+	require.True(t, ok)
+	assert.Equal(t, KeyTypeIP, keyType)
+	assert.Equal(t, "2001:db8:1:2::/64", input.Id)
+
+	r.RemoteAddr = "203.0.113.7:1234"
+	input, _, ok = middleware.rules.Load().extract(r)
+	require.True(t, ok)
+	assert.Equal(t, "203.0.113.7", input.Id)
+}
@@ -0,0 +1,286 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth"
+)
+
+// KeyExtractor tira da requisição a chave e os limites que valem para ela. Com ok falso
+// a requisição não é dele e o próximo extractor da cadeia é tentado.
+// KeyType identifica o tipo da chave para o DenyHandler.
+type KeyExtractor interface {
+	KeyType() string
+	Extract(r *http.Request) (input usecase.LimitInputDTO, ok bool)
+}
+
+// KeyLimits são os limites aplicados às chaves de um extractor.
+// Sem Algorithm, BlockPolicy ou PenaltyDecay valem os do builder.
+type KeyLimits struct {
+	MaxReqs        int32
+	Window         time.Duration
+	BlockTimeBySec int32
+	Burst          int32
+	Algorithm      usecase.LimitAlgorithm
+	BlockPolicy    usecase.BlockPolicy
+	PenaltyDecay   time.Duration
+	Tiers          []usecase.LimitTierDTO
+}
+
+func (l KeyLimits) input(id string) usecase.LimitInputDTO {
+	return usecase.LimitInputDTO{
+		Id:             id,
+		MaxReqs:        l.MaxReqs,
+		Window:         l.Window,
+		BlockTimeBySec: l.BlockTimeBySec,
+		Algorithm:      l.Algorithm,
+		BlockPolicy:    l.BlockPolicy,
+		PenaltyDecay:   l.PenaltyDecay,
+		Burst:          l.Burst,
+		Tiers:          l.Tiers,
+	}
+}
+
+// IPKeyExtractor limita pelo IP do cliente, reconhece qualquer requisição
+type IPKeyExtractor struct {
+	limits     KeyLimits
+	resolver   *ClientIPResolver
+	aggregator *IPPrefixAggregator
+}
+
+// NewIPKeyExtractor aceita resolver e aggregator nulos: o IP é o do peer, sem agregação
+func NewIPKeyExtractor(limits KeyLimits, resolver *ClientIPResolver, aggregator *IPPrefixAggregator) *IPKeyExtractor {
+	if resolver == nil {
+		resolver, _ = NewClientIPResolver(nil, nil)
+	}
+
+	if aggregator == nil {
+		aggregator, _ = NewIPPrefixAggregator(DefaultIPv4Prefix, DefaultIPv6Prefix)
+	}
+
+	return &IPKeyExtractor{
+		limits:     limits,
+		resolver:   resolver,
+		aggregator: aggregator,
+	}
+}
+
+func (e *IPKeyExtractor) KeyType() string {
+	return KeyTypeIP
+}
+
+func (e *IPKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	return e.limits.input(e.aggregator.Key(e.resolver.ClientIP(r))), true
+}
+
+// TokenKeyExtractor limita pelo sub do JWT, com os limites vindos das claims.
+// Só reconhece requisições com um token já verificado no contexto.
+type TokenKeyExtractor struct{}
+
+func NewTokenKeyExtractor() *TokenKeyExtractor {
+	return &TokenKeyExtractor{}
+}
+
+func (e *TokenKeyExtractor) KeyType() string {
+	return KeyTypeToken
+}
+
+func (e *TokenKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	if len(claims) == 0 {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	return tokenLimitInput(claims), true
+}
+
+// HeaderKeyExtractor limita pelo valor de um header, ex: o tenant em X-Tenant-ID.
+// A chave é name:valor, name também é o KeyType.
+type HeaderKeyExtractor struct {
+	name   string
+	header string
+	limits KeyLimits
+}
+
+func NewHeaderKeyExtractor(name string, header string, limits KeyLimits) *HeaderKeyExtractor {
+	return &HeaderKeyExtractor{
+		name:   name,
+		header: header,
+		limits: limits,
+	}
+}
+
+func (e *HeaderKeyExtractor) KeyType() string {
+	return e.name
+}
+
+func (e *HeaderKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	value := strings.TrimSpace(r.Header.Get(e.header))
+	if value == "" {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	return e.limits.input(e.name + ":" + value), true
+}
+
+// ClaimKeyExtractor limita pelo valor de uma claim do JWT já verificado, ex: o tenant do token.
+// Diferente do TokenKeyExtractor os limites são os do extractor, não os das claims.
+type ClaimKeyExtractor struct {
+	name   string
+	claim  string
+	limits KeyLimits
+}
+
+func NewClaimKeyExtractor(name string, claim string, limits KeyLimits) *ClaimKeyExtractor {
+	return &ClaimKeyExtractor{
+		name:   name,
+		claim:  claim,
+		limits: limits,
+	}
+}
+
+func (e *ClaimKeyExtractor) KeyType() string {
+	return e.name
+}
+
+func (e *ClaimKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	value, ok := claims[e.claim]
+	if !ok {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	id := claimString(value)
+	if id == "" {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	return e.limits.input(e.name + ":" + id), true
+}
+
+// GlobalKeyExtractor põe todas as requisições em uma chave só, ex: proteger um serviço externo
+type GlobalKeyExtractor struct {
+	limits KeyLimits
+}
+
+func NewGlobalKeyExtractor(limits KeyLimits) *GlobalKeyExtractor {
+	return &GlobalKeyExtractor{
+		limits: limits,
+	}
+}
+
+func (e *GlobalKeyExtractor) KeyType() string {
+	return PolicyKeyGlobal
+}
+
+func (e *GlobalKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	return e.limits.input(PolicyKeyGlobal), true
+}
+
+// ContextValueKeyExtractor limita por um valor que outro middleware colocou no contexto,
+// ex: o id do usuário da sessão. O valor precisa ser uma string não vazia.
+type ContextValueKeyExtractor struct {
+	name       string
+	contextKey interface{}
+	limits     KeyLimits
+}
+
+func NewContextValueKeyExtractor(name string, contextKey interface{}, limits KeyLimits) *ContextValueKeyExtractor {
+	return &ContextValueKeyExtractor{
+		name:       name,
+		contextKey: contextKey,
+		limits:     limits,
+	}
+}
+
+func (e *ContextValueKeyExtractor) KeyType() string {
+	return e.name
+}
+
+func (e *ContextValueKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	value, _ := r.Context().Value(e.contextKey).(string)
+	if value == "" {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	return e.limits.input(e.name + ":" + value), true
+}
+
+// URLParamKeyExtractor limita por um parâmetro da rota do chi. Os parâmetros só existem
+// depois do roteamento, então o middleware precisa estar na rota, ex: r.With(...).Get(...)
+type URLParamKeyExtractor struct {
+	name   string
+	param  string
+	limits KeyLimits
+}
+
+func NewURLParamKeyExtractor(name string, param string, limits KeyLimits) *URLParamKeyExtractor {
+	return &URLParamKeyExtractor{
+		name:   name,
+		param:  param,
+		limits: limits,
+	}
+}
+
+func (e *URLParamKeyExtractor) KeyType() string {
+	return e.name
+}
+
+func (e *URLParamKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	value := chi.URLParam(r, e.param)
+	if value == "" {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	return e.limits.input(e.name + ":" + value), true
+}
+
+// CompositeKeyExtractor junta as chaves de vários extractors em uma só, ex: tenant e
+// usuário. Só reconhece a requisição se todos reconhecerem, os limites são os do primeiro.
+type CompositeKeyExtractor struct {
+	extractors []KeyExtractor
+}
+
+func NewCompositeKeyExtractor(extractors ...KeyExtractor) *CompositeKeyExtractor {
+	return &CompositeKeyExtractor{
+		extractors: extractors,
+	}
+}
+
+func (e *CompositeKeyExtractor) KeyType() string {
+	keyTypes := make([]string, len(e.extractors))
+	for i, extractor := range e.extractors {
+		keyTypes[i] = extractor.KeyType()
+	}
+
+	return strings.Join(keyTypes, "+")
+}
+
+func (e *CompositeKeyExtractor) Extract(r *http.Request) (usecase.LimitInputDTO, bool) {
+	if len(e.extractors) == 0 {
+		return usecase.LimitInputDTO{}, false
+	}
+
+	var input usecase.LimitInputDTO
+	ids := make([]string, len(e.extractors))
+
+	for i, extractor := range e.extractors {
+		extracted, ok := extractor.Extract(r)
+		if !ok {
+			return usecase.LimitInputDTO{}, false
+		}
+
+		if i == 0 {
+			input = extracted
+		}
+		ids[i] = extracted.Id
+	}
+
+	input.Id = strings.Join(ids, "|")
+
+	return input, true
+}
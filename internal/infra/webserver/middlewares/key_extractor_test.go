@@ -0,0 +1,340 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+type userIDContextKey struct{}
+
+// fakeLimiter guarda os inputs recebidos e nega a partir da requisição deny
+type fakeLimiter struct {
+	inputs       []usecase.LimitInputDTO
+	deny         int
+	offenseLevel int32
+}
+
+func (f *fakeLimiter) Execute(ctx context.Context, input usecase.LimitInputDTO) (usecase.LimitOutputDTO, error) {
+	f.inputs = append(f.inputs, input)
+	if f.deny > 0 && len(f.inputs) >= f.deny {
+		return usecase.LimitOutputDTO{Pass: false, Limit: input.MaxReqs, RetryAfter: time.Second, OffenseLevel: f.offenseLevel}, nil
+	}
+
+	return usecase.LimitOutputDTO{Pass: true, Limit: input.MaxReqs, Remaining: input.MaxReqs - 1, OffenseLevel: f.offenseLevel}, nil
+}
+
+func newTestMiddleware(rules *rateLimitRules, limiter usecase.Limiter) *RateLimitMiddleware {
+	middleware := &RateLimitMiddleware{
+		limitUseCase: limiter,
+		denyHandler:  DefaultDenyHandler,
+	}
+	middleware.rules.Store(rules)
+
+	return middleware
+}
+
+func TestKeyExtractors_Extract(t *testing.T) {
+	limits := KeyLimits{MaxReqs: 10, Window: time.Minute, BlockTimeBySec: 5}
+
+	tests := []struct {
+		name      string
+		extractor KeyExtractor
+		request   func() *http.Request
+		ok        bool
+		id        string
+		keyType   string
+	}{
+		{
+			name:      "ip",
+			extractor: NewIPKeyExtractor(limits, nil, nil),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				return r
+			},
+			ok:      true,
+			id:      "203.0.113.7",
+			keyType: KeyTypeIP,
+		},
+		{
+			name:      "token without claims",
+			extractor: NewTokenKeyExtractor(),
+			request: func() *http.Request {
+				return httptest.NewRequest("GET", "/", nil)
+			},
+			ok: false,
+		},
+		{
+			name:      "header",
+			extractor: NewHeaderKeyExtractor("tenant", "X-Tenant-ID", limits),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-Tenant-ID", "acme")
+				return r
+			},
+			ok:      true,
+			id:      "tenant:acme",
+			keyType: "tenant",
+		},
+		{
+			name:      "header missing",
+			extractor: NewHeaderKeyExtractor("tenant", "X-Tenant-ID", limits),
+			request: func() *http.Request {
+				return httptest.NewRequest("GET", "/", nil)
+			},
+			ok: false,
+		},
+		{
+			name:      "context value",
+			extractor: NewContextValueKeyExtractor("user", userIDContextKey{}, limits),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				return r.WithContext(context.WithValue(r.Context(), userIDContextKey{}, "42"))
+			},
+			ok:      true,
+			id:      "user:42",
+			keyType: "user",
+		},
+		{
+			name:      "context value missing",
+			extractor: NewContextValueKeyExtractor("user", userIDContextKey{}, limits),
+			request: func() *http.Request {
+				return httptest.NewRequest("GET", "/", nil)
+			},
+			ok: false,
+		},
+		{
+			name:      "url param",
+			extractor: NewURLParamKeyExtractor("account", "accountID", limits),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/accounts/99", nil)
+				routeContext := chi.NewRouteContext()
+				routeContext.URLParams.Add("accountID", "99")
+				return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+			},
+			ok:      true,
+			id:      "account:99",
+			keyType: "account",
+		},
+		{
+			name: "composite",
+			extractor: NewCompositeKeyExtractor(
+				NewHeaderKeyExtractor("tenant", "X-Tenant-ID", limits),
+				NewContextValueKeyExtractor("user", userIDContextKey{}, KeyLimits{MaxReqs: 1}),
+			),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-Tenant-ID", "acme")
+				return r.WithContext(context.WithValue(r.Context(), userIDContextKey{}, "42"))
+			},
+			ok:      true,
+			id:      "tenant:acme|user:42",
+			keyType: "tenant+user",
+		},
+		{
+			name: "composite with a missing part",
+			extractor: NewCompositeKeyExtractor(
+				NewHeaderKeyExtractor("tenant", "X-Tenant-ID", limits),
+				NewContextValueKeyExtractor("user", userIDContextKey{}, limits),
+			),
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-Tenant-ID", "acme")
+				return r
+			},
+			ok: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, ok := tt.extractor.Extract(tt.request())
+			require.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+
+			assert.Equal(t, tt.id, input.Id)
+			assert.Equal(t, tt.keyType, tt.extractor.KeyType())
+			assert.Equal(t, limits.MaxReqs, input.MaxReqs)
+			assert.Equal(t, limits.Window, input.Window)
+			assert.Equal(t, limits.BlockTimeBySec, input.BlockTimeBySec)
+		})
+	}
+}
+
+func TestTokenKeyExtractor_Should_use_the_token_claims(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, err := tokenAuth.Encode(map[string]interface{}{
+		"sub":            "api-key",
+		"maxReqs":        100,
+		"windowBySec":    60,
+		"blockTimeBySec": 10,
+	})
+	require.NoError(t, err)
+
+	// Decodifica para que as claims numéricas venham como float64, igual ao Verifier
+	token, err := tokenAuth.Decode(tokenString)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(jwtauth.NewContext(r.Context(), token, nil))
+
+	input, ok := NewTokenKeyExtractor().Extract(r)
+	require.True(t, ok)
+	assert.Equal(t, "api-key", input.Id)
+	assert.Equal(t, int32(100), input.MaxReqs)
+	assert.Equal(t, time.Minute, input.Window)
+	assert.Equal(t, int32(10), input.BlockTimeBySec)
+}
+
+func TestRateLimitMiddleware_Should_fall_through_the_extractor_chain(t *testing.T) {
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{
+			NewHeaderKeyExtractor("tenant", "X-Tenant-ID", KeyLimits{MaxReqs: 100}),
+			NewIPKeyExtractor(KeyLimits{MaxReqs: 5}, nil, nil),
+		},
+		algorithm: usecase.AlgorithmTokenBucket,
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	r.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, limiter.inputs, 2)
+	assert.Equal(t, "tenant:acme", limiter.inputs[0].Id)
+	assert.Equal(t, int32(100), limiter.inputs[0].MaxReqs)
+	assert.Equal(t, "203.0.113.7", limiter.inputs[1].Id)
+	assert.Equal(t, int32(5), limiter.inputs[1].MaxReqs)
+
+	// Sem algorithm no extractor vale o do middleware
+	assert.Equal(t, usecase.AlgorithmTokenBucket, limiter.inputs[0].Algorithm)
+}
+
+func TestRateLimitMiddleware_Should_use_the_block_policy_of_the_key_or_of_the_middleware(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, err := tokenAuth.Encode(map[string]interface{}{
+		"sub":            "api-key",
+		"maxReqs":        100,
+		"blockTimeBySec": 10,
+		"blockPolicy":    "exponential",
+	})
+	require.NoError(t, err)
+
+	token, err := tokenAuth.Decode(tokenString)
+	require.NoError(t, err)
+
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{
+			NewTokenKeyExtractor(),
+			NewHeaderKeyExtractor("tenant", "X-Tenant-ID", KeyLimits{MaxReqs: 100, BlockPolicy: usecase.BlockPolicyExtend}),
+			NewIPKeyExtractor(KeyLimits{MaxReqs: 5}, nil, nil),
+		},
+		blockPolicy: usecase.BlockPolicyFixed,
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(jwtauth.NewContext(r.Context(), token, nil)))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	require.Len(t, limiter.inputs, 3)
+	assert.Equal(t, usecase.BlockPolicyExponential, limiter.inputs[0].BlockPolicy)
+	assert.Equal(t, usecase.BlockPolicyExtend, limiter.inputs[1].BlockPolicy)
+	assert.Equal(t, usecase.BlockPolicyFixed, limiter.inputs[2].BlockPolicy)
+}
+
+func TestRateLimitMiddleware_Should_return_bad_request_when_no_extractor_matches(t *testing.T) {
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{NewTokenKeyExtractor()},
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Empty(t, limiter.inputs)
+}
+
+func TestRateLimitMiddleware_Should_deny_with_the_key_type_of_the_extractor(t *testing.T) {
+	limiter := &fakeLimiter{deny: 1}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{NewHeaderKeyExtractor("tenant", "X-Tenant-ID", KeyLimits{MaxReqs: 100})},
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+	assert.Contains(t, recorder.Body.String(), `"key_type":"tenant"`)
+}
+
+func TestRateLimitMiddleware_Should_report_the_offense_level_and_use_the_penalty_decay(t *testing.T) {
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, err := tokenAuth.Encode(map[string]interface{}{
+		"sub":               "api-key",
+		"maxReqs":           100,
+		"blockTimeBySec":    10,
+		"penaltyDecayBySec": 30,
+	})
+	require.NoError(t, err)
+
+	token, err := tokenAuth.Decode(tokenString)
+	require.NoError(t, err)
+
+	limiter := &fakeLimiter{deny: 2, offenseLevel: 2}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors:   []KeyExtractor{NewTokenKeyExtractor(), NewIPKeyExtractor(KeyLimits{MaxReqs: 5}, nil, nil)},
+		penaltyDecay: time.Hour,
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r.WithContext(jwtauth.NewContext(r.Context(), token, nil)))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("X-RateLimit-Offense-Level"))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("X-RateLimit-Offense-Level"))
+	assert.Contains(t, recorder.Body.String(), `"offense_level":2`)
+
+	// O token define o seu decay, o IP usa o do middleware
+	require.Len(t, limiter.inputs, 2)
+	assert.Equal(t, 30*time.Second, limiter.inputs[0].PenaltyDecay)
+	assert.Equal(t, time.Hour, limiter.inputs[1].PenaltyDecay)
+}
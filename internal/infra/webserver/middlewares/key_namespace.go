@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// KeyNamespace separa as chaves deste serviço no Redis. Prefix vai na frente de todas as
+// chaves gravadas, ex: rl:prod, e os ids passam a levar o tipo da chave, então o IP 1.2.3.4
+// e o token de sub 1.2.3.4 não colidem mais. Com HashTag o valor do id fica entre {} e as
+// chaves dos tiers e as derivadas pelas strategies caem no mesmo slot do Redis Cluster.
+// O zero value mantém o formato legado, só o id.
+type KeyNamespace struct {
+	Prefix  string
+	HashTag bool
+}
+
+func (n KeyNamespace) enabled() bool {
+	return n.Prefix != "" || n.HashTag
+}
+
+// Id devolve o id da chave no namespace: ip:1.2.3.4 ou ip:{1.2.3.4}. Os extractors nomeados
+// já põem o tipo no id, ex: tenant:acme, que não é repetido.
+func (n KeyNamespace) Id(keyType string, id string) string {
+	if !n.enabled() {
+		return id
+	}
+
+	value := strings.TrimPrefix(id, keyType+":")
+	if n.HashTag {
+		value = "{" + value + "}"
+	}
+
+	return keyType + ":" + value
+}
+
+// LegacyId converte um id gravado sem namespace, é o rename do MigrateLegacyKeys. O tipo não
+// era gravado, então é deduzido da última parte do id: IP ou prefixo de IP é ip, UUID é o sub
+// de um token e nome:valor é de um extractor nomeado. Chaves compostas ficam com o tipo da
+// última parte e nos extractors nomeados o tier não se distingue do valor.
+func (n KeyNamespace) LegacyId(legacyId string) string {
+	keyType, id, tier := legacyKeyType(legacyId)
+	return n.Id(keyType, id) + tier
+}
+
+// legacyKeyType separa também o sufixo :nome dos tiers, que no namespace fica fora das {}
+func legacyKeyType(legacyId string) (keyType string, id string, tier string) {
+	wrapper, key := "", legacyId
+	if i := strings.LastIndex(legacyId, "|"); i >= 0 {
+		wrapper, key = legacyId[:i+1], legacyId[i+1:]
+	}
+
+	if isIPKey(key) {
+		return KeyTypeIP, legacyId, ""
+	}
+
+	if i := strings.LastIndex(key, ":"); i >= 0 && isIPKey(key[:i]) {
+		return KeyTypeIP, wrapper + key[:i], key[i:]
+	}
+
+	name, value, named := strings.Cut(key, ":")
+	if _, err := uuid.Parse(name); err == nil {
+		if named {
+			return KeyTypeToken, wrapper + name, ":" + value
+		}
+		return KeyTypeToken, legacyId, ""
+	}
+
+	if key == PolicyKeyGlobal {
+		return PolicyKeyGlobal, legacyId, ""
+	}
+
+	if named {
+		return name, legacyId, ""
+	}
+
+	return KeyTypeToken, legacyId, ""
+}
+
+func isIPKey(key string) bool {
+	if _, err := netip.ParseAddr(key); err == nil {
+		return true
+	}
+
+	_, err := netip.ParsePrefix(key)
+	return err == nil
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyNamespace_Id(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace KeyNamespace
+		keyType   string
+		id        string
+		expected  string
+	}{
+		{name: "zero value keeps the legacy id", keyType: KeyTypeIP, id: "203.0.113.7", expected: "203.0.113.7"},
+		{name: "ip with prefix", namespace: KeyNamespace{Prefix: "rl:prod"}, keyType: KeyTypeIP, id: "203.0.113.7", expected: "ip:203.0.113.7"},
+		{name: "token with prefix", namespace: KeyNamespace{Prefix: "rl:prod"}, keyType: KeyTypeToken, id: "203.0.113.7", expected: "token:203.0.113.7"},
+		{name: "ip with hash tag", namespace: KeyNamespace{Prefix: "rl:prod", HashTag: true}, keyType: KeyTypeIP, id: "2001:db8::/64", expected: "ip:{2001:db8::/64}"},
+		{name: "hash tag without prefix", namespace: KeyNamespace{HashTag: true}, keyType: KeyTypeToken, id: "api-key", expected: "token:{api-key}"},
+		{name: "named extractor type is not repeated", namespace: KeyNamespace{Prefix: "rl:prod"}, keyType: "tenant", id: "tenant:acme", expected: "tenant:acme"},
+		{name: "named extractor with hash tag", namespace: KeyNamespace{HashTag: true}, keyType: "tenant", id: "tenant:acme", expected: "tenant:{acme}"},
+		{name: "route rule id", namespace: KeyNamespace{HashTag: true}, keyType: KeyTypeIP, id: "route:login|203.0.113.7", expected: "ip:{route:login|203.0.113.7}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.namespace.Id(tt.keyType, tt.id))
+		})
+	}
+}
+
+func TestKeyNamespace_LegacyId(t *testing.T) {
+	namespace := KeyNamespace{Prefix: "rl:prod", HashTag: true}
+
+	tests := []struct {
+		name     string
+		legacyId string
+		expected string
+	}{
+		{name: "ipv4", legacyId: "203.0.113.7", expected: "ip:{203.0.113.7}"},
+		{name: "ipv6 prefix", legacyId: "2001:db8:1:2::/64", expected: "ip:{2001:db8:1:2::/64}"},
+		{name: "ipv4 tier stays out of the hash tag", legacyId: "203.0.113.7:minute", expected: "ip:{203.0.113.7}:minute"},
+		{name: "ipv6 prefix tier", legacyId: "2001:db8:1:2::/64:minute", expected: "ip:{2001:db8:1:2::/64}:minute"},
+		{name: "token sub", legacyId: "9b2f7a8e-6c55-4c3e-8a59-0f3f4f7f1a2b", expected: "token:{9b2f7a8e-6c55-4c3e-8a59-0f3f4f7f1a2b}"},
+		{name: "token sub tier", legacyId: "9b2f7a8e-6c55-4c3e-8a59-0f3f4f7f1a2b:hour", expected: "token:{9b2f7a8e-6c55-4c3e-8a59-0f3f4f7f1a2b}:hour"},
+		{name: "named extractor", legacyId: "tenant:acme", expected: "tenant:{acme}"},
+		{name: "route rule over an ip", legacyId: "route:login|203.0.113.7", expected: "ip:{route:login|203.0.113.7}"},
+		{name: "global key", legacyId: "global", expected: "global:{global}"},
+		{name: "anything else is a token", legacyId: "api-key", expected: "token:{api-key}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, namespace.LegacyId(tt.legacyId))
+		})
+	}
+}
+
+func TestRateLimitMiddleware_Should_namespace_the_key_by_type(t *testing.T) {
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{
+			NewHeaderKeyExtractor("tenant", "X-Tenant-ID", KeyLimits{MaxReqs: 100}),
+			NewIPKeyExtractor(KeyLimits{MaxReqs: 5}, nil, nil),
+		},
+	}, limiter)
+	middleware.keyNamespace = KeyNamespace{Prefix: "rl:prod", HashTag: true}
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	r.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, limiter.inputs, 2)
+	assert.Equal(t, "tenant:{acme}", limiter.inputs[0].Id)
+	assert.Equal(t, "ip:{203.0.113.7}", limiter.inputs[1].Id)
+}
+
+func TestRateLimitMiddlewareBuilder_Should_panic_when_key_prefix_has_braces(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRateLimitMiddlewareBuilder().WithKeyNamespace(KeyNamespace{Prefix: "rl:{prod}"})
+	})
+}
+
+func TestRateLimitMiddlewareBuilder_Should_panic_on_redis_cluster_without_hash_tag(t *testing.T) {
+	rdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"localhost:6379"}})
+	defer rdb.Close()
+
+	assert.Panics(t, func() {
+		NewRateLimitMiddlewareBuilder().
+			WithKeyNamespace(KeyNamespace{Prefix: "rl:prod"}).
+			WithRedisClient(rdb).
+			WithRedis("", "").
+			WithRateLimitByIP(5, 5).
+			BuildMiddleware()
+	})
+
+	assert.NotPanics(t, func() {
+		NewRateLimitMiddlewareBuilder().
+			WithKeyNamespace(KeyNamespace{Prefix: "rl:prod", HashTag: true}).
+			WithRedisClient(rdb).
+			WithRedis("", "").
+			WithRateLimitByIP(5, 5).
+			BuildMiddleware()
+	})
+}
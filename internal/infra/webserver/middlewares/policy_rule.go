@@ -0,0 +1,259 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth"
+)
+
+// Estratégias de chave das regras de política, header: e claim: levam o nome depois dos dois pontos
+const (
+	PolicyKeyIP           = "ip"
+	PolicyKeyToken        = "token"
+	PolicyKeyGlobal       = "global"
+	PolicyKeyHeaderPrefix = "header:"
+	PolicyKeyClaimPrefix  = "claim:"
+)
+
+// PolicyRule limita as requisições que casam com Match usando a chave descrita em Key.
+// As regras são avaliadas em ordem e a primeira que casar vence, com contadores próprios.
+// Se nenhuma casar vale a cadeia de extractors do middleware.
+type PolicyRule struct {
+	Name   string
+	Match  PolicyMatch
+	Key    string
+	Limits KeyLimits
+}
+
+// PolicyMatch são os critérios da regra, todos precisam casar. Critério vazio casa com tudo.
+// Em Headers e Claims um valor vazio só exige que o header ou a claim exista.
+type PolicyMatch struct {
+	Methods []string
+	Path    string
+	Headers map[string]string
+	CIDRs   []string
+	Claims  map[string]string
+}
+
+type policyRule struct {
+	name    string
+	methods map[string]bool
+	path    *chi.Mux
+	headers map[string]string
+	cidrs   []*net.IPNet
+	claims  map[string]string
+	key     KeyExtractor
+	limits  KeyLimits
+}
+
+type policyRules struct {
+	rules    []*policyRule
+	resolver *ClientIPResolver
+}
+
+func newPolicyRules(rules []PolicyRule, resolver *ClientIPResolver, aggregator *IPPrefixAggregator) (*policyRules, error) {
+	if resolver == nil {
+		resolver, _ = NewClientIPResolver(nil, nil)
+	}
+
+	policy := &policyRules{
+		rules:    make([]*policyRule, 0, len(rules)),
+		resolver: resolver,
+	}
+
+	names := make(map[string]bool, len(rules))
+
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("policy rule without name")
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicated policy rule: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Limits.MaxReqs <= 0 && len(rule.Limits.Tiers) == 0 {
+			return nil, fmt.Errorf("policy rule %s without limit", rule.Name)
+		}
+
+		compiled, err := compilePolicyRule(rule, resolver, aggregator)
+		if err != nil {
+			return nil, err
+		}
+
+		policy.rules = append(policy.rules, compiled)
+	}
+
+	return policy, nil
+}
+
+func compilePolicyRule(rule PolicyRule, resolver *ClientIPResolver, aggregator *IPPrefixAggregator) (*policyRule, error) {
+	compiled := &policyRule{
+		name:    rule.Name,
+		methods: make(map[string]bool, len(rule.Match.Methods)),
+		headers: make(map[string]string, len(rule.Match.Headers)),
+		claims:  rule.Match.Claims,
+		limits:  rule.Limits,
+	}
+
+	for _, method := range rule.Match.Methods {
+		compiled.methods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	if rule.Match.Path != "" {
+		if !strings.HasPrefix(rule.Match.Path, "/") {
+			return nil, fmt.Errorf("invalid policy rule %s path: %s", rule.Name, rule.Match.Path)
+		}
+
+		path, err := policyPath(rule.Match.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy rule %s path: %v", rule.Name, err)
+		}
+		compiled.path = path
+	}
+
+	for header, value := range rule.Match.Headers {
+		compiled.headers[http.CanonicalHeaderKey(header)] = value
+	}
+
+	for _, cidr := range rule.Match.CIDRs {
+		ipNet, err := parseIPNet(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy rule %s cidr: %s", rule.Name, cidr)
+		}
+		compiled.cidrs = append(compiled.cidrs, ipNet)
+	}
+
+	key, err := policyKeyExtractor(rule.Key, resolver, aggregator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy rule %s: %w", rule.Name, err)
+	}
+	compiled.key = key
+
+	return compiled, nil
+}
+
+// policyPath usa a árvore do chi com uma rota só, converte os panics do chi em erro
+func policyPath(pattern string) (mux *chi.Mux, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%v", recovered)
+		}
+	}()
+
+	mux = chi.NewRouter()
+	mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	return mux, nil
+}
+
+// policyKeyExtractor monta o extractor da estratégia de chave, os limites vêm da regra
+func policyKeyExtractor(key string, resolver *ClientIPResolver, aggregator *IPPrefixAggregator) (KeyExtractor, error) {
+	switch {
+	case key == PolicyKeyIP:
+		return NewIPKeyExtractor(KeyLimits{}, resolver, aggregator), nil
+	case key == PolicyKeyToken:
+		return NewClaimKeyExtractor(KeyTypeToken, "sub", KeyLimits{}), nil
+	case key == PolicyKeyGlobal:
+		return NewGlobalKeyExtractor(KeyLimits{}), nil
+	case strings.HasPrefix(key, PolicyKeyHeaderPrefix) && len(key) > len(PolicyKeyHeaderPrefix):
+		header := strings.TrimPrefix(key, PolicyKeyHeaderPrefix)
+		return NewHeaderKeyExtractor(strings.ToLower(header), header, KeyLimits{}), nil
+	case strings.HasPrefix(key, PolicyKeyClaimPrefix) && len(key) > len(PolicyKeyClaimPrefix):
+		claim := strings.TrimPrefix(key, PolicyKeyClaimPrefix)
+		return NewClaimKeyExtractor(claim, claim, KeyLimits{}), nil
+	default:
+		return nil, fmt.Errorf("unsupported policy key: %s", key)
+	}
+}
+
+// match devolve o input da primeira regra que casar e conseguir extrair a chave
+func (p *policyRules) match(r *http.Request) (usecase.LimitInputDTO, string, bool) {
+	if p == nil {
+		return usecase.LimitInputDTO{}, "", false
+	}
+
+	for _, rule := range p.rules {
+		if !rule.matches(r, p.resolver) {
+			continue
+		}
+
+		input, ok := rule.key.Extract(r)
+		if !ok {
+			continue
+		}
+
+		return rule.limits.input("policy:" + rule.name + "|" + input.Id), rule.key.KeyType(), true
+	}
+
+	return usecase.LimitInputDTO{}, "", false
+}
+
+func (rule *policyRule) matches(r *http.Request, resolver *ClientIPResolver) bool {
+	if len(rule.methods) > 0 && !rule.methods[r.Method] {
+		return false
+	}
+
+	if rule.path != nil {
+		path := r.URL.RawPath
+		if path == "" {
+			path = r.URL.Path
+		}
+
+		if rule.path.Find(chi.NewRouteContext(), r.Method, path) == "" {
+			return false
+		}
+	}
+
+	for header, expected := range rule.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 || (expected != "" && !containsValue(values, expected)) {
+			return false
+		}
+	}
+
+	if len(rule.cidrs) > 0 {
+		ip := net.ParseIP(resolver.ClientIP(r))
+		if ip == nil || !containsIP(rule.cidrs, ip) {
+			return false
+		}
+	}
+
+	if len(rule.claims) > 0 {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		for claim, expected := range rule.claims {
+			value, ok := claims[claim]
+			if !ok || (expected != "" && claimString(value) != expected) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func containsValue(values []string, expected string) bool {
+	for _, value := range values {
+		if strings.TrimSpace(value) == expected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimString compara claims numéricas pelo valor, o JSON as entrega como float64
+func claimString(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
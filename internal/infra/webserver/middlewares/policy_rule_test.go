@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+func TestRateLimitMiddleware_Should_apply_the_first_matching_policy_rule(t *testing.T) {
+	resolver, err := NewClientIPResolver(nil, nil)
+	require.NoError(t, err)
+
+	aggregator, err := NewIPPrefixAggregator(DefaultIPv4Prefix, DefaultIPv6Prefix)
+	require.NoError(t, err)
+
+	policyRules, err := newPolicyRules([]PolicyRule{
+		{
+			Name:   "internal",
+			Match:  PolicyMatch{CIDRs: []string{"10.0.0.0/8"}},
+			Key:    PolicyKeyGlobal,
+			Limits: KeyLimits{MaxReqs: 1000, Window: time.Second},
+		},
+		{
+			Name:   "free-plan",
+			Match:  PolicyMatch{Path: "/rate-limit/*", Claims: map[string]string{"plan": "free"}},
+			Key:    PolicyKeyToken,
+			Limits: KeyLimits{MaxReqs: 10, Window: time.Minute, Algorithm: usecase.AlgorithmSlidingWindowCounter},
+		},
+		{
+			Name:   "tenant",
+			Match:  PolicyMatch{Methods: []string{"post"}, Headers: map[string]string{"x-tenant-id": ""}},
+			Key:    "header:X-Tenant-ID",
+			Limits: KeyLimits{MaxReqs: 20, Window: time.Second},
+		},
+		{
+			Name:   "account",
+			Match:  PolicyMatch{Claims: map[string]string{"account": "7"}},
+			Key:    "claim:account",
+			Limits: KeyLimits{MaxReqs: 3, Window: time.Second},
+		},
+	}, resolver, aggregator)
+	require.NoError(t, err)
+
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	withClaims := func(r *http.Request, claims map[string]interface{}) *http.Request {
+		_, tokenString, err := tokenAuth.Encode(claims)
+		require.NoError(t, err)
+
+		token, err := tokenAuth.Decode(tokenString)
+		require.NoError(t, err)
+
+		return r.WithContext(jwtauth.NewContext(r.Context(), token, nil))
+	}
+
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		policyRules: policyRules,
+		extractors:  []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 5, Window: time.Second}, nil, nil)},
+		algorithm:   usecase.AlgorithmFixedWindow,
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name      string
+		request   func() *http.Request
+		id        string
+		maxReqs   int32
+		algorithm usecase.LimitAlgorithm
+	}{
+		{
+			name: "cidr",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/rate-limit/", nil)
+				r.RemoteAddr = "10.1.2.3:1234"
+				return withClaims(r, map[string]interface{}{"sub": "key", "plan": "free"})
+			},
+			id:        "policy:internal|global",
+			maxReqs:   1000,
+			algorithm: usecase.AlgorithmFixedWindow,
+		},
+		{
+			name: "path and claim",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/rate-limit/orders", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				return withClaims(r, map[string]interface{}{"sub": "key", "plan": "free"})
+			},
+			id:        "policy:free-plan|token:key",
+			maxReqs:   10,
+			algorithm: usecase.AlgorithmSlidingWindowCounter,
+		},
+		{
+			name: "method and header",
+			request: func() *http.Request {
+				r := httptest.NewRequest("POST", "/orders", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				r.Header.Set("X-Tenant-ID", "acme")
+				return r
+			},
+			id:        "policy:tenant|x-tenant-id:acme",
+			maxReqs:   20,
+			algorithm: usecase.AlgorithmFixedWindow,
+		},
+		{
+			name: "numeric claim",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/orders", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				return withClaims(r, map[string]interface{}{"sub": "key", "account": 7})
+			},
+			id:        "policy:account|account:7",
+			maxReqs:   3,
+			algorithm: usecase.AlgorithmFixedWindow,
+		},
+		{
+			name: "no rule falls back to the extractors",
+			request: func() *http.Request {
+				r := httptest.NewRequest("GET", "/orders", nil)
+				r.RemoteAddr = "203.0.113.7:1234"
+				r.Header.Set("X-Tenant-ID", "acme")
+				return r
+			},
+			id:        "203.0.113.7",
+			maxReqs:   5,
+			algorithm: usecase.AlgorithmFixedWindow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.inputs = nil
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, tt.request())
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			require.Len(t, limiter.inputs, 1)
+			assert.Equal(t, tt.id, limiter.inputs[0].Id)
+			assert.Equal(t, tt.maxReqs, limiter.inputs[0].MaxReqs)
+			assert.Equal(t, tt.algorithm, limiter.inputs[0].Algorithm)
+		})
+	}
+}
+
+func TestNewPolicyRules_Should_return_error_when_rules_are_invalid(t *testing.T) {
+	limits := KeyLimits{MaxReqs: 1, Window: time.Second}
+
+	tests := []struct {
+		name  string
+		rules []PolicyRule
+	}{
+		{name: "without name", rules: []PolicyRule{{Key: PolicyKeyIP, Limits: limits}}},
+		{name: "without limit", rules: []PolicyRule{{Name: "a", Key: PolicyKeyIP}}},
+		{name: "unsupported key", rules: []PolicyRule{{Name: "a", Key: "cookie", Limits: limits}}},
+		{name: "header key without name", rules: []PolicyRule{{Name: "a", Key: "header:", Limits: limits}}},
+		{name: "invalid cidr", rules: []PolicyRule{{Name: "a", Key: PolicyKeyIP, Match: PolicyMatch{CIDRs: []string{"10.0.0.0/33"}}, Limits: limits}}},
+		{name: "invalid path", rules: []PolicyRule{{Name: "a", Key: PolicyKeyIP, Match: PolicyMatch{Path: "orders"}, Limits: limits}}},
+		{
+			name: "duplicated",
+			rules: []PolicyRule{
+				{Name: "a", Key: PolicyKeyIP, Limits: limits},
+				{Name: "a", Key: PolicyKeyToken, Limits: limits},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPolicyRules(tt.rules, nil, nil)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -1,185 +1,315 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	inMemoryLimit "github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
 	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/redis/limit"
 	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
 	"github.com/go-chi/jwtauth"
+	"github.com/redis/go-redis/v9"
 )
 
 type RepositoryStrategy string
 
 const (
-	StrategyUnknown RepositoryStrategy = ""
-	StrategyRedis   RepositoryStrategy = "redis"
+	StrategyUnknown          RepositoryStrategy = ""
+	StrategyRedis            RepositoryStrategy = "redis"
+	StrategyRedisApproximate RepositoryStrategy = "redis_approximate"
+	StrategyRedisGCRA        RepositoryStrategy = "redis_gcra"
+	StrategyRedisLeased      RepositoryStrategy = "redis_leased"
 )
 
+// RateLimitMiddleware guarda as regras atrás de um ponteiro atômico para que Reload troque
+// todas de uma vez. Os contadores ficam no limitUseCase, que não muda numa recarga, assim
+// como o keyNamespace que dá nome a eles.
 type RateLimitMiddleware struct {
-	ipRateLimit      bool
-	ipMaxReqsBySec   int32
-	ipBlockTimeBySec int32
-	tokenRateLimit   bool
-	limitUseCase     *usecase.LimitUseCase
+	rules        atomic.Pointer[rateLimitRules]
+	limitUseCase usecase.Limiter
+	limitAdmin   *usecase.LimitAdminUseCase
+	accessList   *usecase.AccessListUseCase
+	denyHandler  DenyHandler
+	keyNamespace KeyNamespace
 }
 
-func (rtlt *RateLimitMiddleware) ReturnRateLimitHandler() func(next http.Handler) http.Handler {
+// rateLimitRules é o conjunto de regras ativo, imutável depois de montado
+type rateLimitRules struct {
+	policyRules      *policyRules
+	extractors       []KeyExtractor
+	routeRules       *routeRules
+	algorithm        usecase.LimitAlgorithm
+	blockPolicy      usecase.BlockPolicy
+	penaltyDecay     time.Duration
+	clientIPResolver *ClientIPResolver
+}
 
-	if rtlt.ipRateLimit && rtlt.tokenRateLimit {
-		return func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-				var id string
-				var reqsBySec, blockTimeBySec int32
-
-				_, claims, _ := jwtauth.FromContext(r.Context())
-
-				if len(claims) > 0 {
-
-					jwtSub, ok := claims["sub"].(string)
-					if !ok {
-						panic("jwt sub property does not exist")
-					}
-					id = jwtSub
-
-					jwtMaxReqsBySec, ok := claims["maxReqsBySec"].(float64)
-					if !ok {
-						panic("jwt maxReqsBySec property does not exist")
-					}
-					reqsBySec = int32(jwtMaxReqsBySec)
-
-					jwtBlockTimeBySec, ok := claims["blockTimeBySec"].(float64)
-					if !ok {
-						panic("jwt blockTimeBySec property does not exist")
-					}
-
-					blockTimeBySec = int32(jwtBlockTimeBySec)
-
-				} else {
-					ip, _, err := net.SplitHostPort(r.RemoteAddr)
-					if err == nil {
-						id = ip
-					} else {
-						id = r.RemoteAddr
-					}
-
-					reqsBySec = rtlt.ipMaxReqsBySec
-					blockTimeBySec = rtlt.ipBlockTimeBySec
-
-				}
-
-				result, err := rtlt.limitUseCase.Execute(r.Context(), usecase.LimitInputDTO{
-					Id:             id,
-					ReqsBySec:      reqsBySec,
-					BlockTimeBySec: blockTimeBySec,
-				})
-				if err != nil {
-					fmt.Printf("Erro no limit use case: %s\n", err.Error())
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-
-				if !result.Pass {
-					w.WriteHeader(http.StatusTooManyRequests)
-					w.Write([]byte("you have reached the maximum number of requests or actions allowed within a certain time frame"))
-					return
-				}
+// tokenLimitInput monta o limite a partir das claims do JWT.
+// Tokens antigos só possuem maxReqsBySec, sem janela, burst, algorithm, blockPolicy,
+// penaltyDecayBySec nem tiers.
+func tokenLimitInput(claims map[string]interface{}) usecase.LimitInputDTO {
+	jwtSub, ok := claims["sub"].(string)
+	if !ok {
+		panic("jwt sub property does not exist")
+	}
 
-				next.ServeHTTP(w, r)
-			})
+	tiers := tokenLimitTiers(claims)
+
+	var maxReqs int32
+	window := time.Second
+	if jwtMaxReqs, ok := claims["maxReqs"].(float64); ok {
+		maxReqs = int32(jwtMaxReqs)
+		window = claimWindow(claims)
+	} else if jwtMaxReqsBySec, ok := claims["maxReqsBySec"].(float64); ok {
+		maxReqs = int32(jwtMaxReqsBySec)
+	} else if len(tiers) == 0 {
+		panic("jwt maxReqs property does not exist")
+	}
+
+	jwtBlockTimeBySec, ok := claims["blockTimeBySec"].(float64)
+	if !ok {
+		panic("jwt blockTimeBySec property does not exist")
+	}
+
+	jwtAlgorithm, _ := claims["algorithm"].(string)
+	jwtBlockPolicy, _ := claims["blockPolicy"].(string)
+	jwtPenaltyDecayBySec, _ := claims["penaltyDecayBySec"].(float64)
+
+	return usecase.LimitInputDTO{
+		Id:             jwtSub,
+		MaxReqs:        maxReqs,
+		Window:         window,
+		BlockTimeBySec: int32(jwtBlockTimeBySec),
+		Algorithm:      usecase.LimitAlgorithm(jwtAlgorithm),
+		BlockPolicy:    usecase.BlockPolicy(jwtBlockPolicy),
+		PenaltyDecay:   time.Duration(jwtPenaltyDecayBySec) * time.Second,
+		Burst:          claimBurst(claims),
+		Tiers:          tiers,
+	}
+}
+
+func tokenLimitTiers(claims map[string]interface{}) []usecase.LimitTierDTO {
+	jwtTiers, ok := claims["tiers"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	tiers := make([]usecase.LimitTierDTO, len(jwtTiers))
+	for i, jwtTier := range jwtTiers {
+		tierClaims, ok := jwtTier.(map[string]interface{})
+		if !ok {
+			panic("jwt tiers property is invalid")
+		}
+
+		name, ok := tierClaims["name"].(string)
+		if !ok {
+			panic("jwt tier name property does not exist")
+		}
+
+		maxReqs, ok := tierClaims["maxReqs"].(float64)
+		if !ok {
+			panic("jwt tier maxReqs property does not exist")
 		}
+
+		blockTimeBySec, _ := tierClaims["blockTimeBySec"].(float64)
+
+		tiers[i] = usecase.LimitTierDTO{
+			Name:           name,
+			MaxReqs:        int32(maxReqs),
+			Window:         claimWindow(tierClaims),
+			BlockTimeBySec: int32(blockTimeBySec),
+			Burst:          claimBurst(tierClaims),
+		}
+	}
+
+	return tiers
+}
+
+func claimWindow(claims map[string]interface{}) time.Duration {
+	if jwtWindowBySec, ok := claims["windowBySec"].(float64); ok && jwtWindowBySec > 0 {
+		return time.Duration(jwtWindowBySec) * time.Second
 	}
 
-	if rtlt.tokenRateLimit {
-		return func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-				var id string
-				var reqsBySec, blockTimeBySec int32
-
-				_, claims, _ := jwtauth.FromContext(r.Context())
-
-				if len(claims) > 0 {
-
-					jwtSub, ok := claims["sub"].(string)
-					if !ok {
-						panic("jwt sub property does not exist")
-					}
-					id = jwtSub
-
-					jwtMaxReqsBySec, ok := claims["maxReqsBySec"].(int32)
-					if !ok {
-						panic("jwt maxReqsBySec property does not exist")
-					}
-					reqsBySec = jwtMaxReqsBySec
-
-					jwtBlockTimeBySec, ok := claims["blockTimeBySec"].(int32)
-					if !ok {
-						panic("jwt blockTimeBySec property does not exist")
-					}
-
-					blockTimeBySec = jwtBlockTimeBySec
-				} else {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("something wrong with your token"))
-					return
-				}
-
-				result, err := rtlt.limitUseCase.Execute(r.Context(), usecase.LimitInputDTO{
-					Id:             id,
-					ReqsBySec:      reqsBySec,
-					BlockTimeBySec: blockTimeBySec,
-				})
-				if err != nil {
-					fmt.Printf("Erro no limit use case: %s\n", err.Error())
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-
-				if !result.Pass {
-					w.WriteHeader(http.StatusTooManyRequests)
-					w.Write([]byte("you have reached the maximum number of requests or actions allowed within a certain time frame"))
-					return
-				}
+	return time.Second
+}
 
-				next.ServeHTTP(w, r)
-			})
+func claimBurst(claims map[string]interface{}) int32 {
+	jwtBurst, _ := claims["burst"].(float64)
+	return int32(jwtBurst)
+}
+
+// setRateLimitHeaders escreve os headers RateLimit do draft da IETF em toda resposta e o
+// Retry-After quando a requisição é negada, sempre em segundos arredondados para cima.
+// Com penalidade progressiva em vigor também informa o nível dela.
+func setRateLimitHeaders(w http.ResponseWriter, result usecase.LimitOutputDTO) {
+	// Todo limite avaliado permite pelo menos uma requisição. Sem limite, como no fail open do
+	// FailoverLimitUseCase, não há o que informar e um RateLimit-Limit 0 só confundiria o cliente.
+	if result.Pass && result.Limit == 0 {
+		return
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(int(result.Limit)))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(result.Remaining)))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+
+	if result.OffenseLevel > 0 {
+		w.Header().Set("X-RateLimit-Offense-Level", strconv.Itoa(int(result.OffenseLevel)))
+	}
+
+	if !result.Pass {
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfterSeconds(result), 10))
+	}
+}
+
+// retryAfterSeconds é o Retry-After de uma requisição negada, sem RetryAfter vale o Reset.
+// Negada, então o cliente precisa esperar pelo menos um segundo.
+func retryAfterSeconds(result usecase.LimitOutputDTO) int64 {
+	retryAfter := result.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = result.Reset
+	}
+
+	return max(1, ceilSeconds(retryAfter))
+}
+
+// deny entrega a requisição negada ao DenyHandler, com o tipo da chave no contexto
+func (rtlt *RateLimitMiddleware) deny(w http.ResponseWriter, r *http.Request, keyType string, result usecase.LimitOutputDTO) {
+	if result.Tier != "" {
+		w.Header().Set("X-RateLimit-Tier", result.Tier)
+	}
+
+	rtlt.denyHandler(w, r.WithContext(context.WithValue(r.Context(), keyTypeContextKey{}, keyType)), result)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((max(0, d) + time.Second - 1) / time.Second)
+}
+
+// extract tenta primeiro as regras de política. Sem nenhuma percorre a cadeia de extractors,
+// o primeiro que reconhecer a requisição vence, e se a rota tiver uma regra os limites
+// passam a ser os dela.
+func (rules *rateLimitRules) extract(r *http.Request) (usecase.LimitInputDTO, string, bool) {
+	if input, keyType, ok := rules.policyRules.match(r); ok {
+		return rules.withDefaults(input), keyType, true
+	}
+
+	for _, extractor := range rules.extractors {
+		input, ok := extractor.Extract(r)
+		if !ok {
+			continue
 		}
+
+		if rule, ok := rules.routeRules.match(r); ok {
+			input = rule.apply(input)
+		}
+
+		return rules.withDefaults(input), extractor.KeyType(), true
+	}
+
+	return usecase.LimitInputDTO{}, "", false
+}
+
+// withDefaults preenche o que a chave não definiu com os padrões do builder
+func (rules *rateLimitRules) withDefaults(input usecase.LimitInputDTO) usecase.LimitInputDTO {
+	if input.Algorithm == "" {
+		input.Algorithm = rules.algorithm
 	}
 
+	if input.BlockPolicy == "" {
+		input.BlockPolicy = rules.blockPolicy
+	}
+
+	if input.PenaltyDecay == 0 {
+		input.PenaltyDecay = rules.penaltyDecay
+	}
+
+	return input
+}
+
+// checkAccess consulta as listas de acesso com o IP do cliente e o sub do JWT. O sub só
+// libera a requisição se o token for válido, um token expirado ou forjado ainda pode ser
+// recusado pelo sub.
+func (rtlt *RateLimitMiddleware) checkAccess(r *http.Request, rules *rateLimitRules) usecase.AccessDecision {
+	if rtlt.accessList == nil {
+		return usecase.AccessNone
+	}
+
+	ip := rules.clientIPResolver.ClientIP(r)
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	sub, _ := claims["sub"].(string)
+
+	decision := rtlt.accessList.Check(ip, sub)
+	if decision == usecase.AccessAllowed && err != nil {
+		return rtlt.accessList.Check(ip, "")
+	}
+
+	return decision
+}
+
+// LimitAdmin devolve a administração das chaves, nil quando a strategy não a suporta
+func (rtlt *RateLimitMiddleware) LimitAdmin() *usecase.LimitAdminUseCase {
+	return rtlt.limitAdmin
+}
+
+// Reload troca as regras pelas montadas com o builder, só os limites e as chaves dele são
+// usados. Se o builder for inválido as regras em uso continuam valendo.
+func (rtlt *RateLimitMiddleware) Reload(b *RateLimitMiddlewareBuilder) error {
+	rules, err := b.buildRules()
+	if err != nil {
+		return err
+	}
+
+	rtlt.rules.Store(rules)
+
+	return nil
+}
+
+func (rtlt *RateLimitMiddleware) ReturnRateLimitHandler() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rules := rtlt.rules.Load()
 
-			var id string
-			var reqsBySec, blockTimeBySec int32
-
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err == nil {
-				id = ip
-			} else {
-				id = r.RemoteAddr
+			switch rtlt.checkAccess(r, rules) {
+			case usecase.AccessDenied:
+				AccessDeniedHandler(w, r)
+				return
+			case usecase.AccessAllowed:
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			reqsBySec = rtlt.ipMaxReqsBySec
-			blockTimeBySec = rtlt.ipBlockTimeBySec
+			input, keyType, ok := rules.extract(r)
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("no rate limit key found for the request"))
+				return
+			}
+			input.Id = rtlt.keyNamespace.Id(keyType, input.Id)
 
-			result, err := rtlt.limitUseCase.Execute(r.Context(), usecase.LimitInputDTO{
-				Id:             id,
-				ReqsBySec:      reqsBySec,
-				BlockTimeBySec: blockTimeBySec,
-			})
+			result, err := rtlt.limitUseCase.Execute(r.Context(), input)
+			if errors.Is(err, usecase.ErrLimitBackend) {
+				fmt.Printf("Backend de limite indisponível: %s\n", err.Error())
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("rate limit backend unavailable"))
+				return
+			}
 			if err != nil {
 				fmt.Printf("Erro no limit use case: %s\n", err.Error())
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 
+			setRateLimitHeaders(w, result)
+
 			if !result.Pass {
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte("you have reached the maximum number of requests or actions allowed within a certain time frame"))
+				rtlt.deny(w, r, keyType, result)
 				return
 			}
 
@@ -190,31 +320,187 @@ func (rtlt *RateLimitMiddleware) ReturnRateLimitHandler() func(next http.Handler
 
 type RateLimitMiddlewareBuilder struct {
 	ipRateLimit        bool
-	ipMaxReqsBySec     int32
+	ipMaxReqs          int32
+	ipWindow           time.Duration
 	ipBlockTimeBySec   int32
+	ipBurst            int32
+	ipTiers            []usecase.LimitTierDTO
 	tokenRateLimit     bool
+	algorithm          usecase.LimitAlgorithm
+	blockPolicy        usecase.BlockPolicy
+	penaltyDecay       time.Duration
 	repositoryStrategy RepositoryStrategy
-	limitRepository    limit_entity.LimitEntityRepository
+	redisHost          string
+	redisPort          string
+	redisClient        redis.UniversalClient
+	keyNamespace       KeyNamespace
+	leaseFraction      float64
+	failurePolicy      usecase.FailurePolicy
+	breakerThreshold   int
+	breakerCooldown    time.Duration
+	denyHandler        DenyHandler
+	trustedProxies     []string
+	clientIPHeaders    []string
+	ipv4Prefix         int
+	ipv6Prefix         int
+	extractors         []KeyExtractor
+	routeRules         []RouteRule
+	policyRules        []PolicyRule
+	accessList         *usecase.AccessListUseCase
 }
 
 func NewRateLimitMiddlewareBuilder() *RateLimitMiddlewareBuilder {
-	return &RateLimitMiddlewareBuilder{}
+	return &RateLimitMiddlewareBuilder{
+		ipv4Prefix: DefaultIPv4Prefix,
+		ipv6Prefix: DefaultIPv6Prefix,
+	}
 }
 
 func (b *RateLimitMiddlewareBuilder) WithRateLimitByIP(ipMaxReqsBySec int32, ipBlockTimeBySec int32) *RateLimitMiddlewareBuilder {
+	return b.WithRateLimitByIPWindow(ipMaxReqsBySec, time.Second, ipBlockTimeBySec)
+}
+
+func (b *RateLimitMiddlewareBuilder) WithRateLimitByIPWindow(ipMaxReqs int32, ipWindow time.Duration, ipBlockTimeBySec int32) *RateLimitMiddlewareBuilder {
 	b.ipRateLimit = true
-	b.ipMaxReqsBySec = ipMaxReqsBySec
+	b.ipMaxReqs = ipMaxReqs
+	b.ipWindow = ipWindow
 	b.ipBlockTimeBySec = ipBlockTimeBySec
 
 	return b
 }
 
+func (b *RateLimitMiddlewareBuilder) WithIPBurst(ipBurst int32) *RateLimitMiddlewareBuilder {
+	b.ipBurst = ipBurst
+
+	return b
+}
+
+// WithIPTiers empilha limites sobre o IP, a requisição é negada se qualquer um estourar
+func (b *RateLimitMiddlewareBuilder) WithIPTiers(ipTiers ...usecase.LimitTierDTO) *RateLimitMiddlewareBuilder {
+	b.ipTiers = ipTiers
+
+	return b
+}
+
 func (b *RateLimitMiddlewareBuilder) WithRateLimitByToken() *RateLimitMiddlewareBuilder {
 	b.tokenRateLimit = true
 
 	return b
 }
 
+func (b *RateLimitMiddlewareBuilder) WithAlgorithm(algorithm usecase.LimitAlgorithm) *RateLimitMiddlewareBuilder {
+	b.algorithm = algorithm
+
+	return b
+}
+
+// WithPenaltyDecay liga a penalidade progressiva das chaves que não definem a sua: cada
+// bloqueio sem decay desde o anterior multiplica o tempo de bloqueio
+func (b *RateLimitMiddlewareBuilder) WithPenaltyDecay(decay time.Duration) *RateLimitMiddlewareBuilder {
+	b.penaltyDecay = decay
+
+	return b
+}
+
+// WithBlockPolicy é a política de extensão do bloqueio das chaves que não definem a sua
+func (b *RateLimitMiddlewareBuilder) WithBlockPolicy(blockPolicy usecase.BlockPolicy) *RateLimitMiddlewareBuilder {
+	b.blockPolicy = blockPolicy
+
+	return b
+}
+
+// WithKeyExtractors acrescenta extractors à cadeia, tentados na ordem em que foram
+// adicionados. Os de WithRateLimitByToken e WithRateLimitByIP ficam no fim, nessa ordem.
+func (b *RateLimitMiddlewareBuilder) WithKeyExtractors(extractors ...KeyExtractor) *RateLimitMiddlewareBuilder {
+	b.extractors = append(b.extractors, extractors...)
+
+	return b
+}
+
+// WithRouteRules acrescenta regras por rota e método, a chave continua vindo dos extractors
+func (b *RateLimitMiddlewareBuilder) WithRouteRules(routeRules ...RouteRule) *RateLimitMiddlewareBuilder {
+	b.routeRules = append(b.routeRules, routeRules...)
+
+	return b
+}
+
+// WithPolicyRules acrescenta regras de política, avaliadas em ordem antes dos extractors
+func (b *RateLimitMiddlewareBuilder) WithPolicyRules(policyRules ...PolicyRule) *RateLimitMiddlewareBuilder {
+	b.policyRules = append(b.policyRules, policyRules...)
+
+	return b
+}
+
+// WithAccessList consulta as listas de acesso antes do limite: deny responde 403 e allow
+// passa sem contar no limite
+func (b *RateLimitMiddlewareBuilder) WithAccessList(accessList *usecase.AccessListUseCase) *RateLimitMiddlewareBuilder {
+	b.accessList = accessList
+
+	return b
+}
+
+// WithDenyHandler troca a resposta padrão, um 429 com problem+json, das requisições negadas
+func (b *RateLimitMiddlewareBuilder) WithDenyHandler(denyHandler DenyHandler) *RateLimitMiddlewareBuilder {
+	b.denyHandler = denyHandler
+
+	return b
+}
+
+// WithTrustedProxies faz o IP do cliente vir dos headers de proxy quando a conexão vem de
+// um dos proxies (CIDR ou IP). headers é a ordem de precedência, vazio usa DefaultClientIPHeaders.
+func (b *RateLimitMiddlewareBuilder) WithTrustedProxies(trustedProxies []string, headers ...string) *RateLimitMiddlewareBuilder {
+	b.trustedProxies = trustedProxies
+	b.clientIPHeaders = headers
+
+	return b
+}
+
+// WithIPPrefixes limita por rede em vez de por endereço, ex: 24 e 64 juntam cada /24
+// IPv4 e cada /64 IPv6 em uma só chave
+func (b *RateLimitMiddlewareBuilder) WithIPPrefixes(ipv4Prefix int, ipv6Prefix int) *RateLimitMiddlewareBuilder {
+	b.ipv4Prefix = ipv4Prefix
+	b.ipv6Prefix = ipv6Prefix
+
+	return b
+}
+
+// WithKeyNamespace separa as chaves no Redis por prefixo e tipo, com hash tags para o Cluster.
+// Não muda numa recarga, trocar o namespace perderia os contadores.
+func (b *RateLimitMiddlewareBuilder) WithKeyNamespace(namespace KeyNamespace) *RateLimitMiddlewareBuilder {
+	// Um prefixo com {} viraria a hash tag das chaves
+	if strings.ContainsAny(namespace.Prefix, "{}") {
+		panic("Prefixo das chaves não pode ter {}!")
+	}
+
+	b.keyNamespace = namespace
+
+	return b
+}
+
+// WithFailurePolicy decide o que fazer quando o Redis falha, sem ela a requisição recebe 503.
+// O circuit breaker abre depois de threshold falhas seguidas e só tenta o Redis de novo
+// depois de cooldown, zero usa os padrões.
+func (b *RateLimitMiddlewareBuilder) WithFailurePolicy(policy usecase.FailurePolicy, threshold int, cooldown time.Duration) *RateLimitMiddlewareBuilder {
+	if !usecase.IsValidFailurePolicy(policy) {
+		panic("Política de falha inválida!")
+	}
+
+	b.failurePolicy = policy
+	b.breakerThreshold, b.breakerCooldown = threshold, cooldown
+
+	return b
+}
+
+// WithRedisClient troca a conexão montada com o host e a porta da strategy, é onde entram
+// a autenticação, o TLS, o pool e os modos sentinel e cluster
+func (b *RateLimitMiddlewareBuilder) WithRedisClient(rdb redis.UniversalClient) *RateLimitMiddlewareBuilder {
+	b.redisClient = rdb
+
+	return b
+}
+
+// WithRedis decide cada requisição atomicamente no Redis, o contador é compartilhado
+// entre todas as instâncias do servidor
 func (b *RateLimitMiddlewareBuilder) WithRedis(host string, port string) *RateLimitMiddlewareBuilder {
 
 	if b.repositoryStrategy != StrategyUnknown {
@@ -222,24 +508,183 @@ func (b *RateLimitMiddlewareBuilder) WithRedis(host string, port string) *RateLi
 	}
 
 	b.repositoryStrategy = StrategyRedis
-	b.limitRepository = limit.NewRedisLimitRepository(host, port)
+	b.redisHost, b.redisPort = host, port
 
 	return b
 
 }
 
-func (b *RateLimitMiddlewareBuilder) Build() func(next http.Handler) http.Handler {
-	if b.repositoryStrategy == StrategyUnknown {
+// WithRedisApproximate decide no cache local de cada instância e só sincroniza com o
+// Redis periodicamente. Mais barato, mas cada instância permite o limite inteiro.
+func (b *RateLimitMiddlewareBuilder) WithRedisApproximate(host string, port string) *RateLimitMiddlewareBuilder {
+
+	if b.repositoryStrategy != StrategyUnknown {
+		panic("Strategy já selecionada!")
+	}
+
+	b.repositoryStrategy = StrategyRedisApproximate
+	b.redisHost, b.redisPort = host, port
+
+	return b
+
+}
+
+func (b *RateLimitMiddlewareBuilder) WithRedisGCRA(host string, port string) *RateLimitMiddlewareBuilder {
+
+	if b.repositoryStrategy != StrategyUnknown {
+		panic("Strategy já selecionada!")
+	}
+
+	b.repositoryStrategy = StrategyRedisGCRA
+	b.redisHost, b.redisPort = host, port
+
+	return b
+
+}
+
+// WithRedisLeased pega do Redis uma fatia do limite de cada chave e a gasta localmente,
+// leaseFraction é o tamanho da fatia em relação ao limite da janela
+func (b *RateLimitMiddlewareBuilder) WithRedisLeased(host string, port string, leaseFraction float64) *RateLimitMiddlewareBuilder {
+
+	if b.repositoryStrategy != StrategyUnknown {
+		panic("Strategy já selecionada!")
+	}
+
+	b.repositoryStrategy = StrategyRedisLeased
+	b.redisHost, b.redisPort = host, port
+	b.leaseFraction = leaseFraction
+
+	return b
+
+}
+
+// BuildMiddleware monta o middleware guardando a referência, necessária para o Reload
+func (b *RateLimitMiddlewareBuilder) BuildMiddleware() *RateLimitMiddleware {
+	var limitUseCase usecase.Limiter
+	var limitAdmin *usecase.LimitAdminUseCase
+
+	redisClient := b.redisClient
+	if redisClient == nil {
+		redisClient = redis.NewClient(limit.NewRedisOptions(b.redisHost, b.redisPort))
+	}
+
+	// No Cluster as chaves de um limite, dos tiers e das derivadas pelas strategies precisam
+	// estar no mesmo slot, os scripts e as transações recebem todas juntas
+	if _, cluster := redisClient.(*redis.ClusterClient); cluster && !b.keyNamespace.HashTag {
+		panic("Redis Cluster precisa de hash tag nas chaves!")
+	}
+
+	// Os repositories só são criados aqui para receberem o prefixo do namespace
+	switch b.repositoryStrategy {
+	case StrategyRedis:
+		repository := limit.NewRedisAtomicLimitRepositoryWithClient(redisClient)
+		repository.KeyPrefix = b.keyNamespace.Prefix
+		limitUseCase = usecase.NewAtomicLimitUseCase(repository)
+		limitAdmin = usecase.NewLimitAdminUseCase(repository, nil)
+	case StrategyRedisApproximate:
+		repository := limit.NewRedisLimitRepositoryWithClient(redisClient)
+		repository.KeyPrefix = b.keyNamespace.Prefix
+		approximateUseCase := usecase.NewLimitUseCase(repository)
+		limitUseCase = approximateUseCase
+		limitAdmin = usecase.NewLimitAdminUseCase(repository, approximateUseCase)
+	case StrategyRedisGCRA:
+		repository := limit.NewRedisGCRALimitRepositoryWithClient(redisClient)
+		repository.KeyPrefix = b.keyNamespace.Prefix
+		limitUseCase = usecase.NewGCRALimitUseCase(repository)
+	case StrategyRedisLeased:
+		repository := limit.NewRedisLimitRepositoryWithClient(redisClient)
+		repository.KeyPrefix = b.keyNamespace.Prefix
+		limitUseCase = usecase.NewLeasedLimitUseCase(repository, b.leaseFraction)
+	default:
 		panic("Nenhuma strategy válida selecionada!")
 	}
 
-	rateLimitMiddleware := RateLimitMiddleware{
-		ipRateLimit:      b.ipRateLimit,
-		ipMaxReqsBySec:   b.ipMaxReqsBySec,
-		ipBlockTimeBySec: b.ipBlockTimeBySec,
-		tokenRateLimit:   b.tokenRateLimit,
-		limitUseCase:     usecase.NewLimitUseCase(b.limitRepository),
+	if b.failurePolicy != "" {
+		var fallback usecase.Limiter
+		if b.failurePolicy == usecase.FailureFallback {
+			// O fallback só conta o que passa por esta instância
+			fallback = usecase.NewLimitUseCase(inMemoryLimit.NewInMemoryLimitRepository())
+		}
+
+		breaker := usecase.NewCircuitBreaker(b.breakerThreshold, b.breakerCooldown)
+		limitUseCase = usecase.NewFailoverLimitUseCase(limitUseCase, b.failurePolicy, fallback, breaker)
+	}
+
+	denyHandler := b.denyHandler
+	if denyHandler == nil {
+		denyHandler = DefaultDenyHandler
+	}
+
+	rules, err := b.buildRules()
+	if err != nil {
+		panic(err)
+	}
+
+	rateLimitMiddleware := &RateLimitMiddleware{
+		limitUseCase: limitUseCase,
+		limitAdmin:   limitAdmin,
+		accessList:   b.accessList,
+		denyHandler:  denyHandler,
+		keyNamespace: b.keyNamespace,
+	}
+	rateLimitMiddleware.rules.Store(rules)
+
+	return rateLimitMiddleware
+}
+
+func (b *RateLimitMiddlewareBuilder) Build() func(next http.Handler) http.Handler {
+	return b.BuildMiddleware().ReturnRateLimitHandler()
+}
+
+// buildRules monta as regras sem olhar a strategy, é o que o Reload troca
+func (b *RateLimitMiddlewareBuilder) buildRules() (*rateLimitRules, error) {
+	clientIPResolver, err := NewClientIPResolver(b.trustedProxies, b.clientIPHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	ipAggregator, err := NewIPPrefixAggregator(b.ipv4Prefix, b.ipv6Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	extractors := append([]KeyExtractor(nil), b.extractors...)
+
+	if b.tokenRateLimit {
+		extractors = append(extractors, NewTokenKeyExtractor())
+	}
+
+	if b.ipRateLimit {
+		extractors = append(extractors, NewIPKeyExtractor(KeyLimits{
+			MaxReqs:        b.ipMaxReqs,
+			Window:         b.ipWindow,
+			BlockTimeBySec: b.ipBlockTimeBySec,
+			Burst:          b.ipBurst,
+			Tiers:          b.ipTiers,
+		}, clientIPResolver, ipAggregator))
+	}
+
+	if len(extractors) == 0 {
+		return nil, errors.New("no key extractor selected")
+	}
+
+	policyRules, err := newPolicyRules(b.policyRules, clientIPResolver, ipAggregator)
+	if err != nil {
+		return nil, err
+	}
+
+	routeRules, err := newRouteRules(b.routeRules)
+	if err != nil {
+		return nil, err
 	}
 
-	return rateLimitMiddleware.ReturnRateLimitHandler()
+	return &rateLimitRules{
+		policyRules:      policyRules,
+		extractors:       extractors,
+		routeRules:       routeRules,
+		algorithm:        b.algorithm,
+		blockPolicy:      b.blockPolicy,
+		penaltyDecay:     b.penaltyDecay,
+		clientIPResolver: clientIPResolver,
+	}, nil
 }
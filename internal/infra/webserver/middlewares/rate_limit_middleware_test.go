@@ -0,0 +1,299 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+)
+
+func TestRateLimitMiddleware_Reload_Should_swap_rules_and_keep_the_limiter(t *testing.T) {
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 5, Window: time.Second}, nil, nil)},
+	}, limiter)
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func() {
+		r := httptest.NewRequest("GET", "/rate-limit/orders", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	request()
+
+	err := middleware.Reload(NewRateLimitMiddlewareBuilder().
+		WithRateLimitByIPWindow(10, time.Minute, 5).
+		WithRouteRules(RouteRule{Method: "POST", Pattern: "/rate-limit/orders", Limits: KeyLimits{MaxReqs: 1}}))
+	require.NoError(t, err)
+
+	request()
+
+	// Regra inválida: a recarga é rejeitada e as regras anteriores continuam valendo
+	err = middleware.Reload(NewRateLimitMiddlewareBuilder().
+		WithRateLimitByIPWindow(20, time.Minute, 5).
+		WithRouteRules(RouteRule{Pattern: "orders", Limits: KeyLimits{MaxReqs: 1}}))
+	assert.Error(t, err)
+
+	err = middleware.Reload(NewRateLimitMiddlewareBuilder())
+	assert.Error(t, err)
+
+	request()
+
+	require.Len(t, limiter.inputs, 3)
+	assert.Equal(t, int32(5), limiter.inputs[0].MaxReqs)
+	assert.Equal(t, time.Second, limiter.inputs[0].Window)
+
+	// A chave não muda, então o contador da chave continua o mesmo
+	for _, input := range limiter.inputs[1:] {
+		assert.Equal(t, limiter.inputs[0].Id, input.Id)
+		assert.Equal(t, int32(10), input.MaxReqs)
+		assert.Equal(t, time.Minute, input.Window)
+	}
+}
+
+func TestRateLimitMiddleware_Should_apply_access_lists_before_the_limit(t *testing.T) {
+	accessList := usecase.NewAccessListUseCase(limit.NewInMemoryLimitRepository())
+	defer accessList.Close()
+
+	err := accessList.SetStaticEntries([]limit_entity.AccessEntry{
+		{Action: limit_entity.AccessAllow, Kind: limit_entity.AccessKindCIDR, Value: "10.0.0.0/8"},
+		{Action: limit_entity.AccessDeny, Kind: limit_entity.AccessKindCIDR, Value: "10.9.0.0/16"},
+		{Action: limit_entity.AccessAllow, Kind: limit_entity.AccessKindSub, Value: "partner"},
+	})
+	require.NoError(t, err)
+
+	err = accessList.AddEntry(context.Background(), limit_entity.AccessEntry{Action: limit_entity.AccessDeny, Kind: limit_entity.AccessKindSub, Value: "abuser"})
+	require.NoError(t, err)
+
+	resolver, err := NewClientIPResolver(nil, nil)
+	require.NoError(t, err)
+
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors:       []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 5, Window: time.Second}, nil, nil)},
+		clientIPResolver: resolver,
+	}, limiter)
+	middleware.accessList = accessList
+	handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tokenAuth := jwtauth.New("HS256", []byte("secret"), nil)
+	withSub := func(r *http.Request, sub string, tokenErr error) *http.Request {
+		_, tokenString, err := tokenAuth.Encode(map[string]interface{}{"sub": sub})
+		require.NoError(t, err)
+
+		token, err := tokenAuth.Decode(tokenString)
+		require.NoError(t, err)
+
+		return r.WithContext(jwtauth.NewContext(r.Context(), token, tokenErr))
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		sub     string
+		err     error
+		status  int
+		limited bool
+	}{
+		{name: "allowed cidr", ip: "10.1.2.3", status: http.StatusOK},
+		{name: "denied cidr wins over allowed cidr", ip: "10.9.1.1", status: http.StatusForbidden},
+		{name: "allowed sub", ip: "203.0.113.7", sub: "partner", status: http.StatusOK},
+		{name: "allowed sub with invalid token", ip: "203.0.113.7", sub: "partner", err: jwtauth.ErrExpired, status: http.StatusOK, limited: true},
+		{name: "denied sub wins over allowed cidr", ip: "10.1.2.3", sub: "abuser", status: http.StatusForbidden},
+		{name: "not listed", ip: "203.0.113.7", status: http.StatusOK, limited: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.inputs = nil
+
+			r := httptest.NewRequest("GET", "/rate-limit/", nil)
+			r.RemoteAddr = tt.ip + ":1234"
+			if tt.sub != "" {
+				r = withSub(r, tt.sub, tt.err)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.limited {
+				assert.Len(t, limiter.inputs, 1)
+			} else {
+				assert.Empty(t, limiter.inputs)
+			}
+
+			if tt.status == http.StatusForbidden {
+				assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+				assert.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+			}
+		})
+	}
+}
+
+type errLimiter struct {
+	err error
+}
+
+func (e *errLimiter) Execute(ctx context.Context, input usecase.LimitInputDTO) (usecase.LimitOutputDTO, error) {
+	return usecase.LimitOutputDTO{Pass: false}, e.err
+}
+
+func TestRateLimitMiddleware_Should_answer_limiter_errors(t *testing.T) {
+	backendErr := fmt.Errorf("%w: connection refused", usecase.ErrLimitBackend)
+
+	tests := []struct {
+		name    string
+		limiter usecase.Limiter
+		status  int
+		limit   string
+	}{
+		{name: "backend error", limiter: &errLimiter{err: backendErr}, status: http.StatusServiceUnavailable},
+		{name: "any other error", limiter: &errLimiter{err: errors.New("unknown limit algorithm: leaky")}, status: http.StatusInternalServerError},
+		{name: "fail closed", limiter: usecase.NewFailoverLimitUseCase(&errLimiter{err: backendErr}, usecase.FailureClosed, nil, usecase.NewCircuitBreaker(1, time.Minute)), status: http.StatusServiceUnavailable},
+		// Nenhum limite foi avaliado, então não há headers de limite
+		{name: "fail open", limiter: usecase.NewFailoverLimitUseCase(&errLimiter{err: backendErr}, usecase.FailureOpen, nil, usecase.NewCircuitBreaker(1, time.Minute)), status: http.StatusOK},
+		{name: "fallback", limiter: usecase.NewFailoverLimitUseCase(&errLimiter{err: backendErr}, usecase.FailureFallback, &fakeLimiter{}, usecase.NewCircuitBreaker(1, time.Minute)), status: http.StatusOK, limit: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := newTestMiddleware(&rateLimitRules{
+				extractors: []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 5, Window: time.Second}, nil, nil)},
+			}, tt.limiter)
+			handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			assert.Equal(t, tt.status, recorder.Code)
+			assert.Equal(t, tt.limit, recorder.Header().Get("RateLimit-Limit"))
+			if tt.limit == "" {
+				assert.Empty(t, recorder.Header().Values("RateLimit-Remaining"))
+				assert.Empty(t, recorder.Header().Values("RateLimit-Reset"))
+				assert.Empty(t, recorder.Header().Values("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareBuilder_Should_wrap_the_limiter_with_the_failure_policy(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRateLimitMiddlewareBuilder().WithFailurePolicy("retry", 0, 0)
+	})
+
+	middleware := NewRateLimitMiddlewareBuilder().
+		WithRedis("localhost", "6379").
+		WithFailurePolicy(usecase.FailureFallback, 0, 0).
+		WithRateLimitByIP(5, 5).
+		BuildMiddleware()
+
+	failover, ok := middleware.limitUseCase.(*usecase.FailoverLimitUseCase)
+	require.True(t, ok)
+	assert.Equal(t, usecase.FailureFallback, failover.Policy)
+	assert.NotNil(t, failover.Fallback)
+	assert.Equal(t, usecase.DEFAULT_BREAKER_THRESHOLD, failover.Breaker.Threshold)
+	assert.Equal(t, usecase.DEFAULT_BREAKER_COOLDOWN, failover.Breaker.Cooldown)
+}
+
+func TestRateLimitMiddleware_Should_write_rate_limit_headers(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     usecase.LimitOutputDTO
+		status     int
+		limit      string
+		remaining  string
+		reset      string
+		retryAfter string
+		offense    string
+	}{
+		{
+			name:      "allowed",
+			result:    usecase.LimitOutputDTO{Pass: true, Limit: 10, Remaining: 7, Reset: 2300 * time.Millisecond},
+			status:    http.StatusOK,
+			limit:     "10",
+			remaining: "7",
+			reset:     "3",
+		},
+		{
+			name:      "allowed with a full limit",
+			result:    usecase.LimitOutputDTO{Pass: true, Limit: 10, Remaining: 9},
+			status:    http.StatusOK,
+			limit:     "10",
+			remaining: "9",
+			reset:     "0",
+		},
+		{
+			name:       "denied",
+			result:     usecase.LimitOutputDTO{Pass: false, Limit: 10, Reset: 4 * time.Second, RetryAfter: 1200 * time.Millisecond},
+			status:     http.StatusTooManyRequests,
+			limit:      "10",
+			remaining:  "0",
+			reset:      "4",
+			retryAfter: "2",
+		},
+		{
+			name:       "denied without retry after uses the reset",
+			result:     usecase.LimitOutputDTO{Pass: false, Limit: 10, Reset: 5 * time.Second},
+			status:     http.StatusTooManyRequests,
+			limit:      "10",
+			remaining:  "0",
+			reset:      "5",
+			retryAfter: "5",
+		},
+		{
+			name:       "denied waits at least one second",
+			result:     usecase.LimitOutputDTO{Pass: false, Limit: 10},
+			status:     http.StatusTooManyRequests,
+			limit:      "10",
+			remaining:  "0",
+			reset:      "0",
+			retryAfter: "1",
+		},
+		{
+			name:       "denied with progressive penalty",
+			result:     usecase.LimitOutputDTO{Pass: false, Limit: 10, RetryAfter: 20 * time.Second, OffenseLevel: 3},
+			status:     http.StatusTooManyRequests,
+			limit:      "10",
+			remaining:  "0",
+			reset:      "0",
+			retryAfter: "20",
+			offense:    "3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := newTestMiddleware(&rateLimitRules{
+				extractors: []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 10, Window: time.Second}, nil, nil)},
+			}, &resultLimiter{result: tt.result})
+			handler := middleware.ReturnRateLimitHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			assert.Equal(t, tt.status, recorder.Code)
+			assert.Equal(t, tt.limit, recorder.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, tt.remaining, recorder.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, tt.reset, recorder.Header().Get("RateLimit-Reset"))
+			assert.Equal(t, tt.retryAfter, recorder.Header().Get("Retry-After"))
+			assert.Equal(t, tt.offense, recorder.Header().Get("X-RateLimit-Offense-Level"))
+		})
+	}
+}
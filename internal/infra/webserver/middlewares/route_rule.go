@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/usecase"
+	"github.com/go-chi/chi/v5"
+)
+
+// RouteRule troca os limites das requisições de uma rota, ex: POST /orders 2/s e GET /orders 50/s.
+// Cada regra tem contadores próprios, então uma rota pesada não consome o limite das outras.
+// Pattern é um padrão do chi com o caminho completo, ex: /rate-limit/orders/{id}.
+// Sem Method a regra vale para qualquer método, uma regra com método tem precedência.
+type RouteRule struct {
+	Method  string
+	Pattern string
+	Limits  KeyLimits
+}
+
+func (rule RouteRule) name() string {
+	method := rule.Method
+	if method == "" {
+		method = "*"
+	}
+
+	return method + " " + rule.Pattern
+}
+
+// routeRules resolve a regra de uma requisição com a árvore de rotas do próprio chi,
+// independente de onde o middleware foi montado
+type routeRules struct {
+	mux   *chi.Mux
+	rules map[string]RouteRule
+}
+
+func newRouteRules(rules []RouteRule) (*routeRules, error) {
+	routes := &routeRules{
+		mux:   chi.NewRouter(),
+		rules: make(map[string]RouteRule, len(rules)),
+	}
+
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// As regras sem método entram antes para que as com método sobrescrevam o endpoint
+	for _, anyMethod := range []bool{true, false} {
+		for _, rule := range rules {
+			rule.Method = strings.ToUpper(strings.TrimSpace(rule.Method))
+			if (rule.Method == "") != anyMethod {
+				continue
+			}
+
+			if !strings.HasPrefix(rule.Pattern, "/") {
+				return nil, fmt.Errorf("invalid route rule pattern: %s", rule.Pattern)
+			}
+
+			if rule.Limits.MaxReqs <= 0 && len(rule.Limits.Tiers) == 0 {
+				return nil, fmt.Errorf("route rule %s without limit", rule.name())
+			}
+
+			if _, ok := routes.rules[rule.name()]; ok {
+				return nil, fmt.Errorf("duplicated route rule: %s", rule.name())
+			}
+
+			if err := routes.register(rule, noop); err != nil {
+				return nil, err
+			}
+			routes.rules[rule.name()] = rule
+		}
+	}
+
+	return routes, nil
+}
+
+// register converte os panics do chi, ex: método desconhecido, em erro
+func (rr *routeRules) register(rule RouteRule, handler http.Handler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("invalid route rule %s: %v", rule.name(), recovered)
+		}
+	}()
+
+	if rule.Method == "" {
+		rr.mux.Handle(rule.Pattern, handler)
+	} else {
+		rr.mux.Method(rule.Method, rule.Pattern, handler)
+	}
+
+	return nil
+}
+
+// match devolve a regra da requisição, ok falso se nenhuma regra casar
+func (rr *routeRules) match(r *http.Request) (RouteRule, bool) {
+	if rr == nil || len(rr.rules) == 0 {
+		return RouteRule{}, false
+	}
+
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+
+	pattern := rr.mux.Find(chi.NewRouteContext(), r.Method, path)
+	if pattern == "" {
+		return RouteRule{}, false
+	}
+
+	if rule, ok := rr.rules[r.Method+" "+pattern]; ok {
+		return rule, true
+	}
+
+	rule, ok := rr.rules["* "+pattern]
+
+	return rule, ok
+}
+
+// apply troca os limites da chave pelos da regra e separa os contadores por regra
+func (rule RouteRule) apply(input usecase.LimitInputDTO) usecase.LimitInputDTO {
+	return rule.Limits.input("route:" + rule.name() + "|" + input.Id)
+}
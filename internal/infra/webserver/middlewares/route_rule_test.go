@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware_Should_apply_route_rules(t *testing.T) {
+	routeRules, err := newRouteRules([]RouteRule{
+		{Method: "POST", Pattern: "/rate-limit/orders", Limits: KeyLimits{MaxReqs: 2, Window: time.Second}},
+		{Method: "get", Pattern: "/rate-limit/orders", Limits: KeyLimits{MaxReqs: 50, Window: time.Second}},
+		{Pattern: "/rate-limit/orders/{id}", Limits: KeyLimits{MaxReqs: 20, Window: time.Minute}},
+		{Method: "DELETE", Pattern: "/rate-limit/orders/{id}", Limits: KeyLimits{MaxReqs: 1, Window: time.Minute}},
+	})
+	require.NoError(t, err)
+
+	limiter := &fakeLimiter{}
+	middleware := newTestMiddleware(&rateLimitRules{
+		extractors: []KeyExtractor{NewIPKeyExtractor(KeyLimits{MaxReqs: 5, Window: time.Second}, nil, nil)},
+		routeRules: routeRules,
+	}, limiter)
+
+	// O middleware roda antes do roteamento do sub-router, como no cmd/server
+	r := chi.NewRouter()
+	r.Route("/rate-limit", func(r chi.Router) {
+		r.Use(middleware.ReturnRateLimitHandler())
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/orders", func(w http.ResponseWriter, r *http.Request) {})
+		r.Post("/orders", func(w http.ResponseWriter, r *http.Request) {})
+		r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		r.Delete("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	tests := []struct {
+		method  string
+		path    string
+		id      string
+		maxReqs int32
+		window  time.Duration
+	}{
+		{method: "POST", path: "/rate-limit/orders", id: "route:POST /rate-limit/orders|203.0.113.7", maxReqs: 2, window: time.Second},
+		{method: "GET", path: "/rate-limit/orders", id: "route:GET /rate-limit/orders|203.0.113.7", maxReqs: 50, window: time.Second},
+		{method: "GET", path: "/rate-limit/orders/42", id: "route:* /rate-limit/orders/{id}|203.0.113.7", maxReqs: 20, window: time.Minute},
+		{method: "DELETE", path: "/rate-limit/orders/42", id: "route:DELETE /rate-limit/orders/{id}|203.0.113.7", maxReqs: 1, window: time.Minute},
+		{method: "GET", path: "/rate-limit/", id: "203.0.113.7", maxReqs: 5, window: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			limiter.inputs = nil
+
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			request.RemoteAddr = "203.0.113.7:1234"
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			require.Len(t, limiter.inputs, 1)
+			assert.Equal(t, tt.id, limiter.inputs[0].Id)
+			assert.Equal(t, tt.maxReqs, limiter.inputs[0].MaxReqs)
+			assert.Equal(t, tt.window, limiter.inputs[0].Window)
+		})
+	}
+}
+
+func TestNewRouteRules_Should_return_error_when_rules_are_invalid(t *testing.T) {
+	limits := KeyLimits{MaxReqs: 1, Window: time.Second}
+
+	tests := []struct {
+		name  string
+		rules []RouteRule
+	}{
+		{name: "pattern without leading slash", rules: []RouteRule{{Pattern: "orders", Limits: limits}}},
+		{name: "unknown method", rules: []RouteRule{{Method: "FETCH", Pattern: "/orders", Limits: limits}}},
+		{name: "without limit", rules: []RouteRule{{Pattern: "/orders"}}},
+		{
+			name: "duplicated",
+			rules: []RouteRule{
+				{Method: "POST", Pattern: "/orders", Limits: limits},
+				{Method: "post", Pattern: "/orders", Limits: limits},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRouteRules(tt.rules)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// Intervalo em que as entradas do repositório são relidas, uma inclusão feita por outra
+// instância demora até isso para valer aqui
+const ACCESS_LIST_REFRESH_DURATION time.Duration = 5 * time.Second
+
+var ErrInvalidAccessEntry = errors.New("invalid access entry")
+
+type AccessDecision int
+
+const (
+	AccessNone AccessDecision = iota
+	AccessAllowed
+	AccessDenied
+)
+
+// Static vem da configuração e só muda numa recarga, Dynamic vem do repositório
+type AccessListOutputDTO struct {
+	Static  []limit_entity.AccessEntry
+	Dynamic []limit_entity.AccessEntry
+}
+
+// accessList é a versão compilada das entradas, trocada inteira a cada mudança
+type accessList struct {
+	allowPrefixes []netip.Prefix
+	denyPrefixes  []netip.Prefix
+	allowSubs     map[string]bool
+	denySubs      map[string]bool
+}
+
+// AccessListUseCase decide, antes do limite, se a requisição pula o limite ou é recusada.
+// As entradas da configuração e as do repositório valem juntas; deny tem precedência sobre allow.
+type AccessListUseCase struct {
+	AccessListRepository limit_entity.AccessListRepository
+	static               []limit_entity.AccessEntry
+	dynamic              []limit_entity.AccessEntry
+	list                 atomic.Pointer[accessList]
+	mutex                *sync.Mutex
+	timer                *time.Timer
+	done                 chan struct{}
+	closeOnce            *sync.Once
+}
+
+func NewAccessListUseCase(AccessListRepository limit_entity.AccessListRepository) *AccessListUseCase {
+	accessListUseCase := &AccessListUseCase{
+		AccessListRepository: AccessListRepository,
+		mutex:                &sync.Mutex{},
+		timer:                time.NewTimer(ACCESS_LIST_REFRESH_DURATION),
+		done:                 make(chan struct{}),
+		closeOnce:            &sync.Once{},
+	}
+
+	if err := accessListUseCase.Refresh(context.Background()); err != nil {
+		fmt.Printf("Erro ao ler as listas de acesso: %s\n", err)
+	}
+
+	accessListUseCase.triggerRefreshRoutine(context.Background())
+
+	return accessListUseCase
+}
+
+func (a *AccessListUseCase) triggerRefreshRoutine(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-a.done:
+				return
+			case <-a.timer.C:
+				if err := a.Refresh(ctx); err != nil {
+					fmt.Printf("Erro ao ler as listas de acesso: %s\n", err)
+				}
+
+				a.timer.Reset(ACCESS_LIST_REFRESH_DURATION)
+			}
+		}
+	}()
+}
+
+// Close para a rotina de leitura do repositório
+func (a *AccessListUseCase) Close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.timer.Stop()
+	})
+}
+
+// Check decide pela lista em memória, sem ir ao repositório. ip e sub vazios são ignorados.
+func (a *AccessListUseCase) Check(ip string, sub string) AccessDecision {
+	list := a.list.Load()
+	if list == nil {
+		return AccessNone
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	hasAddr := err == nil
+	addr = addr.Unmap()
+
+	if (hasAddr && containsAddr(list.denyPrefixes, addr)) || (sub != "" && list.denySubs[sub]) {
+		return AccessDenied
+	}
+
+	if (hasAddr && containsAddr(list.allowPrefixes, addr)) || (sub != "" && list.allowSubs[sub]) {
+		return AccessAllowed
+	}
+
+	return AccessNone
+}
+
+// SetStaticEntries troca as entradas da configuração. Se alguma for inválida nada muda.
+func (a *AccessListUseCase) SetStaticEntries(entries []limit_entity.AccessEntry) error {
+	normalized := make([]limit_entity.AccessEntry, len(entries))
+	for i, entry := range entries {
+		entry, err := NormalizeAccessEntry(entry)
+		if err != nil {
+			return err
+		}
+		normalized[i] = entry
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.static = normalized
+	a.compile()
+
+	return nil
+}
+
+func (a *AccessListUseCase) AddEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	entry, err := NormalizeAccessEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := a.AccessListRepository.AddAccessEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	return a.Refresh(ctx)
+}
+
+func (a *AccessListUseCase) RemoveEntry(ctx context.Context, entry limit_entity.AccessEntry) error {
+	entry, err := NormalizeAccessEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := a.AccessListRepository.RemoveAccessEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	return a.Refresh(ctx)
+}
+
+func (a *AccessListUseCase) ListEntries(ctx context.Context) (AccessListOutputDTO, error) {
+	if err := a.Refresh(ctx); err != nil {
+		return AccessListOutputDTO{}, err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return AccessListOutputDTO{
+		Static:  append([]limit_entity.AccessEntry{}, a.static...),
+		Dynamic: append([]limit_entity.AccessEntry{}, a.dynamic...),
+	}, nil
+}
+
+// Refresh relê as entradas do repositório, as inválidas são ignoradas
+func (a *AccessListUseCase) Refresh(ctx context.Context) error {
+	entries, err := a.AccessListRepository.ListAccessEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	dynamic := make([]limit_entity.AccessEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry, err := NormalizeAccessEntry(entry)
+		if err != nil {
+			continue
+		}
+		dynamic = append(dynamic, entry)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.dynamic = dynamic
+	a.compile()
+
+	return nil
+}
+
+// compile monta a lista em memória, precisa do mutex travado
+func (a *AccessListUseCase) compile() {
+	list := &accessList{
+		allowSubs: make(map[string]bool),
+		denySubs:  make(map[string]bool),
+	}
+
+	for _, entries := range [][]limit_entity.AccessEntry{a.static, a.dynamic} {
+		for _, entry := range entries {
+			switch entry.Kind {
+			case limit_entity.AccessKindCIDR:
+				prefix := netip.MustParsePrefix(entry.Value)
+				if entry.Action == limit_entity.AccessDeny {
+					list.denyPrefixes = append(list.denyPrefixes, prefix)
+				} else {
+					list.allowPrefixes = append(list.allowPrefixes, prefix)
+				}
+			case limit_entity.AccessKindSub:
+				if entry.Action == limit_entity.AccessDeny {
+					list.denySubs[entry.Value] = true
+				} else {
+					list.allowSubs[entry.Value] = true
+				}
+			}
+		}
+	}
+
+	a.list.Store(list)
+}
+
+// NormalizeAccessEntry valida a entrada e deixa o value na forma canônica, um IP solto
+// vira um prefixo com só ele. Assim a mesma entrada escrita de jeitos diferentes é uma só.
+func NormalizeAccessEntry(entry limit_entity.AccessEntry) (limit_entity.AccessEntry, error) {
+	entry.Action = strings.ToLower(strings.TrimSpace(entry.Action))
+	entry.Kind = strings.ToLower(strings.TrimSpace(entry.Kind))
+	entry.Value = strings.TrimSpace(entry.Value)
+
+	if entry.Action != limit_entity.AccessAllow && entry.Action != limit_entity.AccessDeny {
+		return entry, fmt.Errorf("%w: unknown action %q", ErrInvalidAccessEntry, entry.Action)
+	}
+
+	switch entry.Kind {
+	case limit_entity.AccessKindCIDR:
+		prefix, err := parseAccessPrefix(entry.Value)
+		if err != nil {
+			return entry, fmt.Errorf("%w: invalid cidr %q", ErrInvalidAccessEntry, entry.Value)
+		}
+		entry.Value = prefix.String()
+	case limit_entity.AccessKindSub:
+		if entry.Value == "" {
+			return entry, fmt.Errorf("%w: empty sub", ErrInvalidAccessEntry)
+		}
+	default:
+		return entry, fmt.Errorf("%w: unknown kind %q", ErrInvalidAccessEntry, entry.Kind)
+	}
+
+	return entry, nil
+}
+
+func parseAccessPrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	return prefix.Masked(), nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
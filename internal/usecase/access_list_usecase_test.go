@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+)
+
+type AccessListUseCaseTestSuite struct {
+	suite.Suite
+	AccessListRepository *limit.InMemoryLimitRepository
+	Sut                  *AccessListUseCase
+}
+
+func (suite *AccessListUseCaseTestSuite) SetupTest() {
+	AccessListRepository := limit.NewInMemoryLimitRepository()
+	suite.Sut = NewAccessListUseCase(AccessListRepository)
+	suite.AccessListRepository = AccessListRepository
+}
+
+func (suite *AccessListUseCaseTestSuite) TearDownTest() {
+	suite.Sut.Close()
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_return_none_without_entries() {
+	suite.Equal(AccessNone, suite.Sut.Check("203.0.113.7", "key"))
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_check_static_entries() {
+	err := suite.Sut.SetStaticEntries([]limit_entity.AccessEntry{
+		{Action: "allow", Kind: "cidr", Value: "10.0.0.0/8"},
+		{Action: "deny", Kind: "cidr", Value: "10.9.9.9"},
+		{Action: "deny", Kind: "cidr", Value: "2001:db8::/32"},
+		{Action: "ALLOW", Kind: "sub", Value: "partner"},
+		{Action: "deny", Kind: "sub", Value: "abuser"},
+	})
+	suite.Nil(err)
+
+	suite.Equal(AccessAllowed, suite.Sut.Check("10.1.2.3", ""))
+	suite.Equal(AccessAllowed, suite.Sut.Check("::ffff:10.1.2.3", ""))
+	suite.Equal(AccessDenied, suite.Sut.Check("10.9.9.9", ""))
+	suite.Equal(AccessDenied, suite.Sut.Check("2001:db8::1", "partner"))
+	suite.Equal(AccessAllowed, suite.Sut.Check("203.0.113.7", "partner"))
+	suite.Equal(AccessDenied, suite.Sut.Check("10.1.2.3", "abuser"))
+	suite.Equal(AccessNone, suite.Sut.Check("203.0.113.7", "key"))
+	suite.Equal(AccessNone, suite.Sut.Check("", ""))
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_keep_static_entries_when_one_is_invalid() {
+	err := suite.Sut.SetStaticEntries([]limit_entity.AccessEntry{{Action: "deny", Kind: "cidr", Value: "10.0.0.0/8"}})
+	suite.Nil(err)
+
+	err = suite.Sut.SetStaticEntries([]limit_entity.AccessEntry{
+		{Action: "allow", Kind: "cidr", Value: "10.0.0.0/8"},
+		{Action: "deny", Kind: "cidr", Value: "10.0.0.0/33"},
+	})
+	suite.ErrorIs(err, ErrInvalidAccessEntry)
+
+	suite.Equal(AccessDenied, suite.Sut.Check("10.1.2.3", ""))
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_add_and_remove_dynamic_entries() {
+	ctx := context.Background()
+
+	err := suite.Sut.AddEntry(ctx, limit_entity.AccessEntry{Action: "deny", Kind: "cidr", Value: "203.0.113.0/24"})
+	suite.Nil(err)
+	err = suite.Sut.AddEntry(ctx, limit_entity.AccessEntry{Action: "allow", Kind: "sub", Value: "partner"})
+	suite.Nil(err)
+
+	suite.Equal(AccessDenied, suite.Sut.Check("203.0.113.7", ""))
+	suite.Equal(AccessAllowed, suite.Sut.Check("198.51.100.1", "partner"))
+
+	output, err := suite.Sut.ListEntries(ctx)
+	suite.Nil(err)
+	suite.Empty(output.Static)
+	suite.Equal([]limit_entity.AccessEntry{
+		{Action: "allow", Kind: "sub", Value: "partner"},
+		{Action: "deny", Kind: "cidr", Value: "203.0.113.0/24"},
+	}, output.Dynamic)
+
+	// A entrada é normalizada, então pode ser removida escrita de outro jeito
+	err = suite.Sut.RemoveEntry(ctx, limit_entity.AccessEntry{Action: "DENY", Kind: "cidr", Value: "203.0.113.9/24"})
+	suite.Nil(err)
+
+	suite.Equal(AccessNone, suite.Sut.Check("203.0.113.7", ""))
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_see_entries_added_by_another_instance_after_refresh() {
+	ctx := context.Background()
+
+	other := NewAccessListUseCase(suite.AccessListRepository)
+	defer other.Close()
+
+	err := other.AddEntry(ctx, limit_entity.AccessEntry{Action: "deny", Kind: "sub", Value: "abuser"})
+	suite.Nil(err)
+
+	suite.Equal(AccessNone, suite.Sut.Check("", "abuser"))
+
+	err = suite.Sut.Refresh(ctx)
+	suite.Nil(err)
+
+	suite.Equal(AccessDenied, suite.Sut.Check("", "abuser"))
+}
+
+func (suite *AccessListUseCaseTestSuite) TestAccessListUseCase_Should_return_error_when_entry_is_invalid() {
+	entries := []limit_entity.AccessEntry{
+		{Action: "block", Kind: "cidr", Value: "10.0.0.0/8"},
+		{Action: "deny", Kind: "header", Value: "x"},
+		{Action: "deny", Kind: "cidr", Value: "not-an-ip"},
+		{Action: "deny", Kind: "sub", Value: " "},
+	}
+
+	for _, entry := range entries {
+		err := suite.Sut.AddEntry(context.Background(), entry)
+		suite.ErrorIs(err, ErrInvalidAccessEntry)
+	}
+
+	output, err := suite.Sut.ListEntries(context.Background())
+	suite.Nil(err)
+	suite.Empty(output.Dynamic)
+}
+
+func TestAccessListUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessListUseCaseTestSuite))
+}
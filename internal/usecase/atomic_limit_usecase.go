@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// AtomicLimitUseCase delega toda a decisão ao repositório, em uma única operação atômica.
+// Diferente do LimitUseCase não há cache local, então instâncias diferentes do servidor
+// compartilham exatamente o mesmo contador.
+type AtomicLimitUseCase struct {
+	LimitRepository limit_entity.AtomicLimitRepository
+}
+
+func NewAtomicLimitUseCase(LimitRepository limit_entity.AtomicLimitRepository) *AtomicLimitUseCase {
+	return &AtomicLimitUseCase{
+		LimitRepository: LimitRepository,
+	}
+}
+
+func (a *AtomicLimitUseCase) Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error) {
+	if !IsValidLimitAlgorithm(input.Algorithm) {
+		return LimitOutputDTO{Pass: false}, fmt.Errorf("unknown limit algorithm: %s", input.Algorithm)
+	}
+
+	if err := validateBlockPolicy(input.BlockPolicy); err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	tiers, err := resolveTiers(input)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	rules := make([]limit_entity.AtomicLimitRule, len(tiers))
+	for i, tier := range tiers {
+		rules[i] = limit_entity.AtomicLimitRule{
+			Key:          tier.Input.Id,
+			Algorithm:    string(normalizeLimitAlgorithm(tier.Input.Algorithm)),
+			MaxReqs:      tier.Input.MaxReqs,
+			Window:       windowOf(tier.Input),
+			Burst:        tier.Input.Burst,
+			BlockTime:    time.Duration(tier.Input.BlockTimeBySec) * time.Second,
+			BlockPolicy:  string(normalizeBlockPolicy(tier.Input.BlockPolicy)),
+			MaxBlockTime: MAX_BLOCK_DURATION,
+			PenaltyDecay: tier.Input.PenaltyDecay,
+		}
+	}
+
+	decision, err := a.LimitRepository.EvaluateLimit(ctx, rules)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, fmt.Errorf("%w: %w", ErrLimitBackend, err)
+	}
+
+	output := LimitOutputDTO{
+		Pass:         decision.Allowed,
+		Limit:        decision.Limit,
+		Remaining:    decision.Remaining,
+		Reset:        decision.Reset,
+		RetryAfter:   decision.RetryAfter,
+		OffenseLevel: decision.OffenseLevel,
+	}
+
+	if !decision.Allowed {
+		output.Tier = tiers[decision.DeniedRule].Name
+	}
+
+	return output, nil
+}
@@ -0,0 +1,523 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/redis/limit"
+)
+
+type AtomicLimitUseCaseRedisTestSuite struct {
+	suite.Suite
+	LimitRepository *limit.RedisAtomicLimitRepository
+	Sut             *AtomicLimitUseCase
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) SetupTest() {
+	LimitRepository := limit.NewRedisAtomicLimitRepository("localhost", "6379")
+	suite.Sut = NewAtomicLimitUseCase(LimitRepository)
+	suite.LimitRepository = LimitRepository
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TearDownTest() {
+	err := suite.LimitRepository.Rdb.FlushDB(context.Background()).Err()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TearDownSuite() {
+	suite.LimitRepository.Rdb.Close()
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_pass_one_single_request() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+	})
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_return_error_when_algorithm_is_unknown() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+		Algorithm:      "leaky_bucket",
+	})
+	suite.NotNil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_block_and_keep_blocked_with_fixed_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        3,
+		BlockTimeBySec: 1,
+	}
+
+	for range 3 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(time.Second, output.RetryAfter)
+
+	// Requisições durante o bloqueio reiniciam o bloqueio
+	time.Sleep(600 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	time.Sleep(600 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_deny_without_blocking_when_block_time_is_zero() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_refill_tokens_with_token_bucket() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmTokenBucket,
+		Burst:          4,
+	}
+
+	for range 4 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	// 2 tokens por segundo, em 600ms volta pelo menos 1
+	time.Sleep(600 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_limit_with_sliding_window_counter() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        3,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowCounter,
+		Window:         2 * time.Second,
+	}
+
+	for range 3 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_report_denied_tier_and_not_consume_other_tiers() {
+	limitInput := LimitInputDTO{
+		Id: "IP",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 2, Window: time.Second},
+			{Name: "minute", MaxReqs: 3, Window: time.Minute},
+		},
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	// Nega no tier de segundo sem consumir o tier de minuto
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal("second", output.Tier)
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal("minute", output.Tier)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_not_exceed_limit_across_instances() {
+	algorithms := []LimitAlgorithm{
+		AlgorithmFixedWindow,
+		AlgorithmSlidingWindowLog,
+		AlgorithmTokenBucket,
+		AlgorithmSlidingWindowCounter,
+	}
+
+	for _, algorithm := range algorithms {
+		suite.Run(string(algorithm), func() {
+			// Cada instância do servidor tem o seu próprio use case e conexão
+			instances := make([]*AtomicLimitUseCase, 4)
+			for i := range instances {
+				repository := limit.NewRedisAtomicLimitRepository("localhost", "6379")
+				defer repository.Rdb.Close()
+				instances[i] = NewAtomicLimitUseCase(repository)
+			}
+
+			limitInput := LimitInputDTO{
+				Id:             "IP-" + string(algorithm),
+				MaxReqs:        10,
+				BlockTimeBySec: 0,
+				Algorithm:      algorithm,
+				Window:         time.Minute,
+			}
+
+			var passed atomic.Int32
+			var wg sync.WaitGroup
+			for _, instance := range instances {
+				for range 25 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						output, err := instance.Execute(context.Background(), limitInput)
+						suite.Nil(err)
+						if output.Pass {
+							passed.Add(1)
+						}
+					}()
+				}
+			}
+			wg.Wait()
+
+			suite.Equal(int32(10), passed.Load())
+		})
+	}
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_report_limit_remaining_and_reset_with_fixed_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        3,
+		BlockTimeBySec: 5,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(3), output.Limit)
+	suite.Equal(int32(2), output.Remaining)
+	suite.Equal(time.Second, output.Reset)
+	suite.Equal(time.Duration(0), output.RetryAfter)
+
+	for range 2 {
+		output, err = suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.Equal(int32(0), output.Remaining)
+
+	// Bloqueado, só libera depois do tempo de bloqueio
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(3), output.Limit)
+	suite.Equal(int32(0), output.Remaining)
+	suite.Equal(5*time.Second, output.RetryAfter)
+	suite.Equal(5*time.Second, output.Reset)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_report_retry_after_when_token_bucket_is_empty() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmTokenBucket,
+		Burst:          4,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(4), output.Limit)
+	suite.Equal(int32(3), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.Reset, float64(10*time.Millisecond))
+
+	for range 3 {
+		output, err = suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	// 2 tokens por segundo, um token a cada 500ms
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.RetryAfter, float64(10*time.Millisecond))
+	suite.InDelta(2*time.Second, output.Reset, float64(20*time.Millisecond))
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_report_retry_after_when_sliding_window_log_denies() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	time.Sleep(300 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+
+	// Passa quando a primeira sair da janela, o limite fica inteiro quando a segunda sair
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.InDelta(700*time.Millisecond, output.RetryAfter, float64(50*time.Millisecond))
+	suite.InDelta(time.Second, output.Reset, float64(50*time.Millisecond))
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_report_tier_closest_to_deny() {
+	limitInput := LimitInputDTO{
+		Id: "IP",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 5, Window: time.Second},
+			{Name: "minute", MaxReqs: 2, Window: time.Minute},
+		},
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(2), output.Limit)
+	suite.Equal(int32(1), output.Remaining)
+	suite.Equal(time.Minute, output.Reset)
+	suite.Equal("", output.Tier)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_apply_the_block_policy() {
+	runLimiterCases(&suite.Suite, suite.Sut, blockPolicyCases)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_penalize_repeat_offenders() {
+	runLimiterCases(&suite.Suite, suite.Sut, penaltyCases)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_expire_state_and_log_keys() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		Window:         2 * time.Second,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	// O estado e o log só precisam durar uma janela
+	for _, key := range []string{"atomic:IP", "atomic:IP:log"} {
+		ttl, err := suite.LimitRepository.Rdb.PTTL(context.Background(), key).Result()
+		suite.Nil(err)
+		suite.Greater(ttl, time.Duration(0))
+		suite.LessOrEqual(ttl, 2*time.Second)
+	}
+
+	// Bloqueada, o estado dura até o fim do bloqueio
+	for range 2 {
+		_, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+	}
+
+	ttl, err := suite.LimitRepository.Rdb.PTTL(context.Background(), "atomic:IP").Result()
+	suite.Nil(err)
+	suite.Greater(ttl, 2*time.Second)
+	suite.LessOrEqual(ttl, 5*time.Second)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_keep_counting_after_migrating_legacy_keys() {
+	ctx := context.Background()
+	limitInput := LimitInputDTO{
+		Id:             "203.0.113.7",
+		MaxReqs:        3,
+		Window:         time.Minute,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(ctx, limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	legacyRepository := limit.NewRedisLimitRepository("localhost", "6379")
+	defer legacyRepository.Rdb.Close()
+	err := legacyRepository.AddAccessEntry(ctx, limit_entity.AccessEntry{Action: limit_entity.AccessDeny, Kind: limit_entity.AccessKindCIDR, Value: "198.51.100.0/24"})
+	suite.Nil(err)
+
+	migrator := limit.NewRedisLimitRepository("localhost", "6379")
+	defer migrator.Rdb.Close()
+	migrator.KeyPrefix = "rl:test"
+
+	migrated, err := migrator.MigrateLegacyKeys(ctx, func(id string) string {
+		return "ip:{" + id + "}"
+	})
+	suite.Nil(err)
+	// Estado, log e lista de acesso
+	suite.Equal(3, migrated)
+
+	keys, err := suite.LimitRepository.Rdb.Keys(ctx, "*").Result()
+	suite.Nil(err)
+	suite.ElementsMatch([]string{"rl:test:atomic:ip:{203.0.113.7}", "rl:test:atomic:ip:{203.0.113.7}:log", "rl:test:access_list"}, keys)
+
+	entries, err := migrator.ListAccessEntries(ctx)
+	suite.Nil(err)
+	suite.Len(entries, 1)
+
+	// O mesmo limite, agora no namespace, continua de onde parou
+	prefixedRepository := limit.NewRedisAtomicLimitRepository("localhost", "6379")
+	defer prefixedRepository.Rdb.Close()
+	prefixedRepository.KeyPrefix = "rl:test"
+	prefixed := NewAtomicLimitUseCase(prefixedRepository)
+
+	limitInput.Id = "ip:{203.0.113.7}"
+	output, err := prefixed.Execute(ctx, limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+
+	output, err = prefixed.Execute(ctx, limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	// Rodar de novo não encontra mais nada
+	migrated, err = migrator.MigrateLegacyKeys(ctx, func(id string) string {
+		return "ip:{" + id + "}"
+	})
+	suite.Nil(err)
+	suite.Equal(0, migrated)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_not_migrate_without_a_key_prefix() {
+	_, err := limit.NewRedisLimitRepository("localhost", "6379").MigrateLegacyKeys(context.Background(), func(id string) string {
+		return id
+	})
+	suite.NotNil(err)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_connect_with_the_redis_config() {
+	ctx := context.Background()
+	rdb, err := limit.RedisConfig{
+		URL:         "redis://localhost:6379/0",
+		DB:          1,
+		PoolSize:    2,
+		DialTimeout: time.Second,
+		Protocol:    3,
+	}.NewClient()
+	suite.Nil(err)
+	defer rdb.Close()
+	defer rdb.FlushDB(ctx)
+
+	_, standalone := rdb.(*redis.Client)
+	suite.True(standalone)
+
+	repository := limit.NewRedisAtomicLimitRepositoryWithClient(rdb)
+	output, err := NewAtomicLimitUseCase(repository).Execute(ctx, LimitInputDTO{Id: "IP", MaxReqs: 1, BlockTimeBySec: 5})
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	// O limite foi gravado no DB 1, o DB 0 da suite continua vazio
+	keys, err := rdb.Keys(ctx, "*").Result()
+	suite.Nil(err)
+	suite.Equal([]string{"atomic:IP"}, keys)
+
+	keys, err = suite.LimitRepository.Rdb.Keys(ctx, "*").Result()
+	suite.Nil(err)
+	suite.Empty(keys)
+}
+
+func (suite *AtomicLimitUseCaseRedisTestSuite) TestAtomicLimitUseCase_Should_fail_open_when_redis_is_down() {
+	rdb, err := limit.RedisConfig{Host: "localhost", Port: "1", DialTimeout: 100 * time.Millisecond}.NewClient()
+	suite.Nil(err)
+	defer rdb.Close()
+
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 1, BlockTimeBySec: 5}
+	down := NewAtomicLimitUseCase(limit.NewRedisAtomicLimitRepositoryWithClient(rdb))
+
+	_, err = down.Execute(context.Background(), limitInput)
+	suite.ErrorIs(err, ErrLimitBackend)
+
+	sut := NewFailoverLimitUseCase(down, FailureOpen, nil, NewCircuitBreaker(1, time.Minute))
+	for range 3 {
+		output, err := sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.True(sut.Breaker.Open())
+}
+
+func TestAtomicLimitUseCaseRedisTestSuite(t *testing.T) {
+	suite.Run(t, new(AtomicLimitUseCaseRedisTestSuite))
+}
@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// BlockPolicy diz o que acontece com uma requisição que chega durante o bloqueio
+type BlockPolicy string
+
+const (
+	// BlockPolicyExtend reinicia o bloqueio a cada requisição, quem insiste nunca é liberado
+	BlockPolicyExtend BlockPolicy = "extend"
+	// BlockPolicyFixed mantém o fim do bloqueio, as requisições só são negadas
+	BlockPolicyFixed BlockPolicy = "fixed"
+	// BlockPolicyExponential dobra o bloqueio a cada requisição, até MAX_BLOCK_DURATION
+	BlockPolicyExponential BlockPolicy = "exponential"
+)
+
+// Teto do bloqueio exponencial
+const MAX_BLOCK_DURATION time.Duration = 24 * time.Hour
+
+// Sem política informada vale extend, o comportamento original
+func normalizeBlockPolicy(policy BlockPolicy) BlockPolicy {
+	if policy == "" {
+		return BlockPolicyExtend
+	}
+
+	return policy
+}
+
+func IsValidBlockPolicy(policy BlockPolicy) bool {
+	switch normalizeBlockPolicy(policy) {
+	case BlockPolicyExtend, BlockPolicyFixed, BlockPolicyExponential:
+		return true
+	}
+
+	return false
+}
+
+// penaltyBlockTime é o bloqueio do input no nível de penalidade offenses
+func penaltyBlockTime(input LimitInputDTO, offenses int32) time.Duration {
+	return limit_entity.PenaltyBlockTime(time.Duration(input.BlockTimeBySec)*time.Second, offenses, MAX_BLOCK_DURATION)
+}
+
+func validateBlockPolicy(policy BlockPolicy) error {
+	if !IsValidBlockPolicy(policy) {
+		return fmt.Errorf("unknown block policy: %s", policy)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_BREAKER_THRESHOLD int           = 5
+	DEFAULT_BREAKER_COOLDOWN  time.Duration = 10 * time.Second
+)
+
+// CircuitBreaker para de chamar o backend depois de Threshold falhas seguidas. Aberto, nenhuma
+// chamada passa por Cooldown, depois só uma passa de teste: se der certo ele fecha, se falhar
+// abre de novo.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DEFAULT_BREAKER_THRESHOLD
+	}
+
+	if cooldown <= 0 {
+		cooldown = DEFAULT_BREAKER_COOLDOWN
+	}
+
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+// Allow diz se a chamada pode ir ao backend. Quem recebe true precisa informar o resultado
+// com Success, Failure ou Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.openUntil.IsZero() {
+		fmt.Println("Circuit breaker fechado, backend de limite respondeu")
+	}
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// Failure retorna quantas falhas seguidas já houve, contando esta
+func (b *CircuitBreaker) Failure() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	if b.probing || b.failures >= b.Threshold {
+		// Só avisa quando abre, a chamada de teste que falha mantém o breaker aberto
+		if b.openUntil.IsZero() {
+			fmt.Printf("Circuit breaker aberto por %s depois de %d falhas\n", b.Cooldown, b.failures)
+		}
+		b.openUntil = time.Now().Add(b.Cooldown)
+	}
+	b.probing = false
+
+	return b.failures
+}
+
+// Release devolve uma chamada que não diz nada sobre o backend, ex: requisição cancelada
+func (b *CircuitBreaker) Release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+}
+
+// Open diz se as chamadas estão sendo recusadas
+func (b *CircuitBreaker) Open() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return !b.openUntil.IsZero()
+}
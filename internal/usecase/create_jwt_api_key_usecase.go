@@ -1,16 +1,42 @@
 package usecase
 
-import "github.com/HalexV/pos-go-expert-desafio-rate-limiter/pkg/entity"
+import (
+	"fmt"
 
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/pkg/entity"
+)
+
+// MaxReqsBySec é mantido por compatibilidade, equivale a MaxReqs com janela de um segundo
 type CreateJWTAPIKeyInputDTO struct {
-	MaxReqsBySec   int32 `json:"max_reqs_by_sec"`
-	BlockTimeBySec int32 `json:"block_time_by_sec"`
+	MaxReqsBySec      int32                    `json:"max_reqs_by_sec"`
+	MaxReqs           int32                    `json:"max_reqs"`
+	WindowBySec       int32                    `json:"window_by_sec"`
+	BlockTimeBySec    int32                    `json:"block_time_by_sec"`
+	Burst             int32                    `json:"burst"`
+	Algorithm         LimitAlgorithm           `json:"algorithm"`
+	BlockPolicy       BlockPolicy              `json:"block_policy"`
+	PenaltyDecayBySec int32                    `json:"penalty_decay_by_sec"`
+	Tiers             []CreateJWTAPIKeyTierDTO `json:"tiers,omitempty"`
 }
 
 type CreateJWTAPIKeyOutputDTO struct {
-	ID             entity.ID `json:"id"`
-	MaxReqsBySec   int32     `json:"max_reqs_by_sec"`
-	BlockTimeBySec int32     `json:"block_time_by_sec"`
+	ID                entity.ID                `json:"id"`
+	MaxReqs           int32                    `json:"max_reqs"`
+	WindowBySec       int32                    `json:"window_by_sec"`
+	BlockTimeBySec    int32                    `json:"block_time_by_sec"`
+	Burst             int32                    `json:"burst"`
+	Algorithm         LimitAlgorithm           `json:"algorithm"`
+	BlockPolicy       BlockPolicy              `json:"block_policy"`
+	PenaltyDecayBySec int32                    `json:"penalty_decay_by_sec"`
+	Tiers             []CreateJWTAPIKeyTierDTO `json:"tiers,omitempty"`
+}
+
+type CreateJWTAPIKeyTierDTO struct {
+	Name           string `json:"name"`
+	MaxReqs        int32  `json:"max_reqs"`
+	WindowBySec    int32  `json:"window_by_sec"`
+	BlockTimeBySec int32  `json:"block_time_by_sec"`
+	Burst          int32  `json:"burst"`
 }
 
 type CreateJWTAPIKeyUseCase struct{}
@@ -21,10 +47,73 @@ func NewCreateJWTAPIKeyUseCase() *CreateJWTAPIKeyUseCase {
 
 func (c *CreateJWTAPIKeyUseCase) Execute(input CreateJWTAPIKeyInputDTO) (CreateJWTAPIKeyOutputDTO, error) {
 
+	if !IsValidLimitAlgorithm(input.Algorithm) {
+		return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("unknown limit algorithm: %s", input.Algorithm)
+	}
+
+	if err := validateBlockPolicy(input.BlockPolicy); err != nil {
+		return CreateJWTAPIKeyOutputDTO{}, err
+	}
+
+	if input.PenaltyDecayBySec < 0 {
+		return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("penalty decay must not be negative")
+	}
+
+	if input.Burst < 0 {
+		return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("burst must not be negative")
+	}
+
+	maxReqs, windowBySec := input.MaxReqs, input.WindowBySec
+	if maxReqs == 0 {
+		maxReqs, windowBySec = input.MaxReqsBySec, 1
+	}
+
+	// Com tiers o limite principal é opcional, sem eles a chave não teria limite nenhum
+	if maxReqs < 0 || (maxReqs == 0 && len(input.Tiers) == 0) {
+		return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("max reqs must be greater than zero")
+	}
+
+	if windowBySec < 0 {
+		return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("window must not be negative")
+	}
+
+	if windowBySec == 0 {
+		windowBySec = 1
+	}
+
+	tiers := make([]CreateJWTAPIKeyTierDTO, 0, len(input.Tiers))
+	names := make(map[string]bool, len(input.Tiers))
+	for _, tier := range input.Tiers {
+		if tier.Name == "" {
+			return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("tier name is required")
+		}
+
+		if names[tier.Name] {
+			return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("duplicated tier name: %s", tier.Name)
+		}
+		names[tier.Name] = true
+
+		if tier.MaxReqs <= 0 || tier.WindowBySec < 0 || tier.BlockTimeBySec < 0 || tier.Burst < 0 {
+			return CreateJWTAPIKeyOutputDTO{}, fmt.Errorf("invalid limits for tier: %s", tier.Name)
+		}
+
+		if tier.WindowBySec == 0 {
+			tier.WindowBySec = 1
+		}
+
+		tiers = append(tiers, tier)
+	}
+
 	dto := CreateJWTAPIKeyOutputDTO{
-		ID:             entity.NewID(),
-		MaxReqsBySec:   input.MaxReqsBySec,
-		BlockTimeBySec: input.BlockTimeBySec,
+		ID:                entity.NewID(),
+		MaxReqs:           maxReqs,
+		WindowBySec:       windowBySec,
+		BlockTimeBySec:    input.BlockTimeBySec,
+		Burst:             input.Burst,
+		Algorithm:         input.Algorithm,
+		BlockPolicy:       input.BlockPolicy,
+		PenaltyDecayBySec: input.PenaltyDecayBySec,
+		Tiers:             tiers,
 	}
 
 	return dto, nil
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CreateJWTAPIKeyUseCaseTestSuite struct {
+	suite.Suite
+	Sut *CreateJWTAPIKeyUseCase
+}
+
+func (suite *CreateJWTAPIKeyUseCaseTestSuite) SetupTest() {
+	suite.Sut = NewCreateJWTAPIKeyUseCase()
+}
+
+func (suite *CreateJWTAPIKeyUseCaseTestSuite) TestCreateJWTAPIKeyUseCase_Should_create_key_with_max_reqs() {
+	output, err := suite.Sut.Execute(CreateJWTAPIKeyInputDTO{MaxReqs: 10, WindowBySec: 60, BlockTimeBySec: 5})
+	suite.Nil(err)
+	suite.NotEmpty(output.ID)
+	suite.Equal(int32(10), output.MaxReqs)
+	suite.Equal(int32(60), output.WindowBySec)
+	suite.Equal(int32(5), output.BlockTimeBySec)
+}
+
+func (suite *CreateJWTAPIKeyUseCaseTestSuite) TestCreateJWTAPIKeyUseCase_Should_accept_legacy_max_reqs_by_sec() {
+	output, err := suite.Sut.Execute(CreateJWTAPIKeyInputDTO{MaxReqsBySec: 3, BlockTimeBySec: 5})
+	suite.Nil(err)
+	suite.Equal(int32(3), output.MaxReqs)
+	suite.Equal(int32(1), output.WindowBySec)
+}
+
+func (suite *CreateJWTAPIKeyUseCaseTestSuite) TestCreateJWTAPIKeyUseCase_Should_reject_missing_max_reqs_without_tiers() {
+	for _, input := range []CreateJWTAPIKeyInputDTO{
+		{BlockTimeBySec: 5},
+		{MaxReqs: -1, BlockTimeBySec: 5},
+		{MaxReqsBySec: -1, BlockTimeBySec: 5},
+	} {
+		_, err := suite.Sut.Execute(input)
+		suite.EqualError(err, "max reqs must be greater than zero")
+	}
+}
+
+func (suite *CreateJWTAPIKeyUseCaseTestSuite) TestCreateJWTAPIKeyUseCase_Should_allow_only_tiers() {
+	output, err := suite.Sut.Execute(CreateJWTAPIKeyInputDTO{
+		Tiers: []CreateJWTAPIKeyTierDTO{{Name: "minute", MaxReqs: 60, WindowBySec: 60, BlockTimeBySec: 5}},
+	})
+	suite.Nil(err)
+	suite.Equal(int32(0), output.MaxReqs)
+	suite.Len(output.Tiers, 1)
+
+	_, err = suite.Sut.Execute(CreateJWTAPIKeyInputDTO{
+		MaxReqs: -1,
+		Tiers:   []CreateJWTAPIKeyTierDTO{{Name: "minute", MaxReqs: 60, WindowBySec: 60}},
+	})
+	suite.EqualError(err, "max reqs must be greater than zero")
+}
+
+func TestCreateJWTAPIKeyUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(CreateJWTAPIKeyUseCaseTestSuite))
+}
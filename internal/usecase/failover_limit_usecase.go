@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrLimitBackend marca os erros do repositório, os demais erros dos Limiters são do input
+var ErrLimitBackend = errors.New("limit backend unavailable")
+
+// FailurePolicy é o que fazer com a requisição quando o backend de limite falha
+type FailurePolicy string
+
+const (
+	FailureClosed   FailurePolicy = "closed"   // Nega, o middleware responde 503
+	FailureOpen     FailurePolicy = "open"     // Deixa passar sem limite
+	FailureFallback FailurePolicy = "fallback" // Limita com o Limiter local de cada instância
+)
+
+func IsValidFailurePolicy(policy FailurePolicy) bool {
+	switch policy {
+	case FailureClosed, FailureOpen, FailureFallback:
+		return true
+	}
+
+	return false
+}
+
+// FailoverLimitUseCase aplica a FailurePolicy quando o Limiter falha e, com o circuit breaker
+// aberto, nem chega a chamá-lo. Os contadores do Fallback não são compartilhados e não voltam
+// para o backend quando ele se recupera.
+type FailoverLimitUseCase struct {
+	Limiter  Limiter
+	Fallback Limiter
+	Policy   FailurePolicy
+	Breaker  *CircuitBreaker
+}
+
+func NewFailoverLimitUseCase(limiter Limiter, policy FailurePolicy, fallback Limiter, breaker *CircuitBreaker) *FailoverLimitUseCase {
+	return &FailoverLimitUseCase{
+		Limiter:  limiter,
+		Fallback: fallback,
+		Policy:   policy,
+		Breaker:  breaker,
+	}
+}
+
+func (f *FailoverLimitUseCase) Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error) {
+	if !f.Breaker.Allow() {
+		return f.fail(ctx, input, fmt.Errorf("%w: circuit breaker open", ErrLimitBackend))
+	}
+
+	output, err := f.Limiter.Execute(ctx, input)
+	if err == nil {
+		f.Breaker.Success()
+		return output, nil
+	}
+
+	if !errors.Is(err, ErrLimitBackend) {
+		f.Breaker.Release()
+		return output, err
+	}
+
+	// A requisição cancelada não quer dizer que o backend caiu
+	if ctx.Err() != nil {
+		f.Breaker.Release()
+		return output, err
+	}
+
+	// Só a primeira falha seguida é logada, as próximas ficam com os avisos do breaker abrindo
+	// e fechando
+	if f.Breaker.Failure() == 1 {
+		fmt.Printf("Falha no backend de limite, aplicando a política %s: %s\n", f.Policy, err)
+	}
+
+	return f.fail(ctx, input, err)
+}
+
+func (f *FailoverLimitUseCase) fail(ctx context.Context, input LimitInputDTO, err error) (LimitOutputDTO, error) {
+	switch f.Policy {
+	case FailureOpen:
+		return LimitOutputDTO{Pass: true}, nil
+	case FailureFallback:
+		return f.Fallback.Execute(ctx, input)
+	}
+
+	return LimitOutputDTO{Pass: false}, err
+}
@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+)
+
+// failingGCRALimitRepository simula um Redis fora do ar enquanto Failing estiver ligado
+type failingGCRALimitRepository struct {
+	*limit.InMemoryGCRALimitRepository
+	Failing atomic.Bool
+	Calls   atomic.Int32
+}
+
+func (r *failingGCRALimitRepository) AllowGCRA(ctx context.Context, rules []limit_entity.GCRARule) (*limit_entity.GCRADecision, error) {
+	r.Calls.Add(1)
+	if r.Failing.Load() {
+		return nil, errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+	}
+
+	return r.InMemoryGCRALimitRepository.AllowGCRA(ctx, rules)
+}
+
+type FailoverLimitUseCaseTestSuite struct {
+	suite.Suite
+	LimitRepository *failingGCRALimitRepository
+	Fallback        *LimitUseCase
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) SetupTest() {
+	suite.LimitRepository = &failingGCRALimitRepository{InMemoryGCRALimitRepository: limit.NewInMemoryGCRALimitRepository()}
+	suite.Fallback = NewLimitUseCase(limit.NewInMemoryLimitRepository())
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TearDownTest() {
+	suite.Fallback.Close()
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) newSut(policy FailurePolicy, breaker *CircuitBreaker) *FailoverLimitUseCase {
+	return NewFailoverLimitUseCase(NewGCRALimitUseCase(suite.LimitRepository), policy, suite.Fallback, breaker)
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_use_the_limiter_while_the_backend_is_up() {
+	sut := suite.newSut(FailureOpen, NewCircuitBreaker(1, time.Minute))
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 1, BlockTimeBySec: 5}
+
+	output, err := sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	output, err = sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_fail_closed_with_a_backend_error() {
+	sut := suite.newSut(FailureClosed, NewCircuitBreaker(5, time.Minute))
+	suite.LimitRepository.Failing.Store(true)
+
+	output, err := sut.Execute(context.Background(), LimitInputDTO{Id: "IP", MaxReqs: 5, BlockTimeBySec: 5})
+	suite.ErrorIs(err, ErrLimitBackend)
+	suite.False(output.Pass)
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_fail_open_when_the_backend_fails() {
+	sut := suite.newSut(FailureOpen, NewCircuitBreaker(5, time.Minute))
+	suite.LimitRepository.Failing.Store(true)
+
+	for range 10 {
+		output, err := sut.Execute(context.Background(), LimitInputDTO{Id: "IP", MaxReqs: 1, BlockTimeBySec: 5})
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_limit_locally_with_the_fallback() {
+	sut := suite.newSut(FailureFallback, NewCircuitBreaker(5, time.Minute))
+	suite.LimitRepository.Failing.Store(true)
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 2, BlockTimeBySec: 5}
+
+	for _, pass := range []bool{true, true, false} {
+		output, err := sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.Equal(pass, output.Pass)
+	}
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_not_treat_an_invalid_input_as_a_backend_failure() {
+	sut := suite.newSut(FailureOpen, NewCircuitBreaker(1, time.Minute))
+
+	output, err := sut.Execute(context.Background(), LimitInputDTO{Id: "IP", MaxReqs: 0, BlockTimeBySec: 5})
+	suite.NotNil(err)
+	suite.NotErrorIs(err, ErrLimitBackend)
+	suite.False(output.Pass)
+	suite.False(sut.Breaker.Open())
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_not_count_a_canceled_request_as_a_failure() {
+	sut := suite.newSut(FailureClosed, NewCircuitBreaker(1, time.Minute))
+	suite.LimitRepository.Failing.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := sut.Execute(ctx, LimitInputDTO{Id: "IP", MaxReqs: 5, BlockTimeBySec: 5})
+	suite.ErrorIs(err, ErrLimitBackend)
+	suite.False(sut.Breaker.Open())
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_stop_calling_the_backend_while_the_breaker_is_open() {
+	sut := suite.newSut(FailureClosed, NewCircuitBreaker(3, 200*time.Millisecond))
+	suite.LimitRepository.Failing.Store(true)
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 5, BlockTimeBySec: 5}
+
+	for range 10 {
+		_, err := sut.Execute(context.Background(), limitInput)
+		suite.ErrorIs(err, ErrLimitBackend)
+	}
+
+	// Só as falhas até abrir chegaram ao backend
+	suite.Equal(int32(3), suite.LimitRepository.Calls.Load())
+	suite.True(sut.Breaker.Open())
+
+	// Depois do cooldown uma chamada de teste falha e o breaker abre de novo
+	time.Sleep(250 * time.Millisecond)
+	for range 5 {
+		_, err := sut.Execute(context.Background(), limitInput)
+		suite.ErrorIs(err, ErrLimitBackend)
+	}
+	suite.Equal(int32(4), suite.LimitRepository.Calls.Load())
+
+	// Com o backend de volta a chamada de teste fecha o breaker
+	suite.LimitRepository.Failing.Store(false)
+	time.Sleep(250 * time.Millisecond)
+	for range 5 {
+		output, err := sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.Equal(int32(9), suite.LimitRepository.Calls.Load())
+	suite.False(sut.Breaker.Open())
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_reset_the_failures_after_a_success() {
+	sut := suite.newSut(FailureOpen, NewCircuitBreaker(2, time.Minute))
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 100, BlockTimeBySec: 5}
+
+	// Falhas intercaladas com sucessos nunca chegam a duas seguidas
+	for range 5 {
+		suite.LimitRepository.Failing.Store(true)
+		_, err := sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+
+		suite.LimitRepository.Failing.Store(false)
+		_, err = sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+	}
+
+	suite.False(sut.Breaker.Open())
+	suite.Equal(int32(10), suite.LimitRepository.Calls.Load())
+}
+
+// captureStdout devolve o que run escreveu no stdout, onde ficam os logs
+func captureStdout(run func()) string {
+	stdout := os.Stdout
+	reader, writer, _ := os.Pipe()
+	os.Stdout = writer
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	run()
+
+	writer.Close()
+	os.Stdout = stdout
+
+	return <-output
+}
+
+func (suite *FailoverLimitUseCaseTestSuite) TestFailoverLimitUseCase_Should_log_the_first_failure_of_each_streak() {
+	for _, policy := range []FailurePolicy{FailureOpen, FailureFallback} {
+		suite.Run(string(policy), func() {
+			suite.LimitRepository.Failing.Store(true)
+			sut := suite.newSut(policy, NewCircuitBreaker(3, time.Minute))
+			limitInput := LimitInputDTO{Id: "IP", MaxReqs: 100, BlockTimeBySec: 5}
+
+			logs := captureStdout(func() {
+				for range 10 {
+					output, err := sut.Execute(context.Background(), limitInput)
+					suite.Nil(err)
+					suite.True(output.Pass)
+				}
+			})
+
+			// Uma linha com o erro na primeira falha e outra quando o breaker abre
+			lines := strings.Split(strings.TrimSpace(logs), "\n")
+			suite.Len(lines, 2)
+			suite.Contains(lines[0], "política "+string(policy))
+			suite.Contains(lines[0], "connection refused")
+			suite.Contains(lines[1], "Circuit breaker aberto")
+
+			// Abaixo do threshold a falha também é logada, e a seguinte não
+			sut = suite.newSut(policy, NewCircuitBreaker(3, time.Minute))
+			logs = captureStdout(func() {
+				for range 2 {
+					_, err := sut.Execute(context.Background(), limitInput)
+					suite.Nil(err)
+				}
+			})
+			suite.Equal(1, strings.Count(logs, "Falha no backend de limite"))
+
+			// Um sucesso encerra a sequência e a próxima falha é logada de novo
+			suite.LimitRepository.Failing.Store(false)
+			logs = captureStdout(func() {
+				_, err := sut.Execute(context.Background(), limitInput)
+				suite.Nil(err)
+
+				suite.LimitRepository.Failing.Store(true)
+				_, err = sut.Execute(context.Background(), limitInput)
+				suite.Nil(err)
+			})
+			suite.Equal(1, strings.Count(logs, "Falha no backend de limite"))
+		})
+	}
+}
+
+func TestFailoverLimitUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(FailoverLimitUseCaseTestSuite))
+}
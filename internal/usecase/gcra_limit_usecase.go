@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// GCRALimitUseCase decide cada requisição direto no repositório, sem cache local.
+// MaxReqs por Window define o intervalo de emissão e Burst quantas requisições podem chegar juntas.
+type GCRALimitUseCase struct {
+	LimitRepository limit_entity.GCRALimitRepository
+}
+
+func NewGCRALimitUseCase(LimitRepository limit_entity.GCRALimitRepository) *GCRALimitUseCase {
+	return &GCRALimitUseCase{
+		LimitRepository: LimitRepository,
+	}
+}
+
+func (g *GCRALimitUseCase) Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error) {
+	if err := validateBlockPolicy(input.BlockPolicy); err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	tiers, err := resolveTiers(input)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	rules := make([]limit_entity.GCRARule, len(tiers))
+	bursts := make([]int32, len(tiers))
+	for i, tier := range tiers {
+		if tier.Input.MaxReqs <= 0 {
+			return LimitOutputDTO{Pass: false}, errors.New("max reqs must be greater than zero")
+		}
+
+		burst := tier.Input.Burst
+		if burst <= 0 {
+			burst = tier.Input.MaxReqs
+		}
+
+		bursts[i] = burst
+
+		emissionInterval := windowOf(tier.Input) / time.Duration(tier.Input.MaxReqs)
+
+		rules[i] = limit_entity.GCRARule{
+			Key:              tier.Input.Id,
+			EmissionInterval: emissionInterval,
+			BurstTolerance:   emissionInterval * time.Duration(burst),
+			BlockTime:        time.Duration(tier.Input.BlockTimeBySec) * time.Second,
+			BlockPolicy:      string(normalizeBlockPolicy(tier.Input.BlockPolicy)),
+			MaxBlockTime:     MAX_BLOCK_DURATION,
+			PenaltyDecay:     tier.Input.PenaltyDecay,
+		}
+	}
+
+	decision, err := g.LimitRepository.AllowGCRA(ctx, rules)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, fmt.Errorf("%w: %w", ErrLimitBackend, err)
+	}
+
+	output := LimitOutputDTO{
+		Pass:         decision.Allowed,
+		Limit:        bursts[decision.LimitingRule],
+		Remaining:    decision.Remaining,
+		Reset:        decision.Reset,
+		RetryAfter:   decision.RetryAfter,
+		OffenseLevel: decision.OffenseLevel,
+	}
+
+	if !decision.Allowed {
+		output.Tier = tiers[decision.DeniedRule].Name
+	}
+
+	return output, nil
+}
@@ -0,0 +1,279 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+)
+
+type GCRALimitUseCaseTestSuite struct {
+	suite.Suite
+	LimitRepository *limit.InMemoryGCRALimitRepository
+	Sut             *GCRALimitUseCase
+}
+
+func (suite *GCRALimitUseCaseTestSuite) SetupTest() {
+	LimitRepository := limit.NewInMemoryGCRALimitRepository()
+	suite.Sut = NewGCRALimitUseCase(LimitRepository)
+	suite.LimitRepository = LimitRepository
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_pass_one_single_request() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+	})
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(time.Duration(0), output.RetryAfter)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_return_error_when_max_reqs_is_zero() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        0,
+		BlockTimeBySec: 5,
+	})
+	suite.NotNil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_deny_after_burst_with_retry_after_when_block_time_is_zero() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Burst:          3,
+	}
+
+	for range 3 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output4.Pass)
+	suite.Greater(output4.RetryAfter, time.Duration(0))
+	suite.LessOrEqual(output4.RetryAfter, 500*time.Millisecond)
+
+	time.Sleep(output4.RetryAfter)
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output5.Pass)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_block_after_five_same_requests_in_a_second() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 1,
+	}
+
+	for range 5 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output6, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output6.Pass)
+	suite.Equal(1*time.Second, output6.RetryAfter)
+
+	// Ainda bloqueado mesmo depois do intervalo de emissão
+	time.Sleep(300 * time.Millisecond)
+
+	output7, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output7.Pass)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	output8, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output8.Pass)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_pass_exactly_burst_of_concurrent_requests() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        10,
+		BlockTimeBySec: 5,
+	}
+
+	var passed atomic.Int32
+	testWG := &sync.WaitGroup{}
+
+	for range 30 {
+		testWG.Add(1)
+		go func() {
+			defer testWG.Done()
+
+			output, err := suite.Sut.Execute(context.Background(), limitInput)
+			suite.Nil(err)
+			if output.Pass {
+				passed.Add(1)
+			}
+		}()
+	}
+
+	testWG.Wait()
+
+	suite.Equal(int32(10), passed.Load())
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_spread_emission_interval_over_the_configured_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        60,
+		Window:         time.Minute,
+		BlockTimeBySec: 0,
+		Burst:          1,
+	}
+
+	output1, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output1.Pass)
+
+	// Sessenta por minuto é uma requisição por segundo
+	output2, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output2.Pass)
+	suite.Greater(output2.RetryAfter, 900*time.Millisecond)
+	suite.LessOrEqual(output2.RetryAfter, time.Second)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_deny_when_any_stacked_tier_is_exceeded_and_report_the_tier() {
+	limitInput := LimitInputDTO{
+		Id: "TOKEN",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 10, Window: time.Second},
+			{Name: "minute", MaxReqs: 4, Window: time.Minute},
+		},
+	}
+
+	for range 4 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output5.Pass)
+	suite.Equal("minute", output5.Tier)
+	suite.Greater(output5.RetryAfter, 10*time.Second)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_not_consume_other_tiers_when_one_denies() {
+	limitInput := LimitInputDTO{
+		Id: "TOKEN",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 2, Window: time.Second},
+			{Name: "minute", MaxReqs: 5, Window: time.Minute},
+		},
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	// Negadas pelo tier de segundo, não podem gastar o tier de minuto
+	for range 10 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.False(output.Pass)
+		suite.Equal("second", output.Tier)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_report_limit_remaining_and_reset() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Burst:          4,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(4), output.Limit)
+	suite.Equal(int32(3), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.Reset, float64(10*time.Millisecond))
+
+	for range 3 {
+		output, err = suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.Equal(int32(0), output.Remaining)
+
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.RetryAfter, float64(10*time.Millisecond))
+	suite.InDelta(2*time.Second, output.Reset, float64(20*time.Millisecond))
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_apply_the_block_policy() {
+	runLimiterCases(&suite.Suite, suite.Sut, blockPolicyCases)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_penalize_repeat_offenders() {
+	runLimiterCases(&suite.Suite, suite.Sut, penaltyCases)
+}
+
+func (suite *GCRALimitUseCaseTestSuite) TestGCRALimitUseCase_Should_keep_repository_bounded_under_a_stream_of_unique_ips() {
+	suite.LimitRepository.SweepInterval = 100 * time.Millisecond
+
+	// IPs que nunca voltam e estouram o limite, deixando TAT e bloqueio para trás
+	for i := range 3000 {
+		limitInput := LimitInputDTO{
+			Id:             fmt.Sprintf("IP.%d", i),
+			MaxReqs:        1,
+			BlockTimeBySec: 1,
+		}
+
+		for range 2 {
+			_, err := suite.Sut.Execute(context.Background(), limitInput)
+			suite.Nil(err)
+		}
+
+		if i%100 == 99 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	suite.LimitRepository.Mutex.Lock()
+	tats, blocks := len(suite.LimitRepository.Db), len(suite.LimitRepository.Blocks)
+	suite.LimitRepository.Mutex.Unlock()
+	suite.LessOrEqual(tats, 1500)
+	suite.LessOrEqual(blocks, 1500)
+}
+
+func TestGCRALimitUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(GCRALimitUseCaseTestSuite))
+}
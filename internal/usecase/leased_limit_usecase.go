@@ -0,0 +1,280 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+// Fração do limite de cada janela pedida ao repositório por vez
+const DEFAULT_LEASE_FRACTION float64 = 0.2
+
+// quotaLease é a fatia do limite de uma chave que a instância pode gastar sozinha
+type quotaLease struct {
+	Remaining    int32
+	Available    int32 // O que restava no repositório na última concessão
+	WindowStart  time.Time
+	WindowEnd    time.Time
+	FreeAt       *time.Time
+	Exhausted    bool  // O repositório não tinha mais nada para conceder nesta janela
+	OffenseLevel int32 // Nível de penalidade na última ida ao repositório
+	LastUsedAt   time.Time
+	Mutex        *sync.Mutex
+}
+
+// LeasedLimitUseCase fica entre o LimitUseCase, que decide só com o cache local, e o
+// AtomicLimitUseCase, que vai ao repositório a cada requisição. Cada instância pega
+// uma fatia do limite da janela e a gasta localmente, voltando ao repositório só
+// quando ela acaba. O que não foi usado é devolvido quando a chave fica ociosa.
+// Como as fatias são descontadas do total da janela, as instâncias juntas nunca passam
+// do limite; só uma diferença de relógio entre elas pode somar até uma fatia a mais.
+// Apenas o fixed window é suportado. O bloqueio é respeitado localmente sem voltar ao
+// repositório, então qualquer BlockPolicy se comporta como fixed.
+type LeasedLimitUseCase struct {
+	LimitRepository limit_entity.QuotaLeaseRepository
+	LeaseFraction   float64
+	Leases          map[string]*quotaLease
+	UseCaseMutex    *sync.Mutex
+	ClearMutex      *sync.RWMutex
+	timer           *time.Timer
+	done            chan struct{}
+	closeOnce       *sync.Once
+}
+
+func NewLeasedLimitUseCase(LimitRepository limit_entity.QuotaLeaseRepository, leaseFraction float64) *LeasedLimitUseCase {
+	if leaseFraction <= 0 || leaseFraction > 1 {
+		leaseFraction = DEFAULT_LEASE_FRACTION
+	}
+
+	leasedLimitUseCase := &LeasedLimitUseCase{
+		LimitRepository: LimitRepository,
+		LeaseFraction:   leaseFraction,
+		Leases:          make(map[string]*quotaLease),
+		UseCaseMutex:    &sync.Mutex{},
+		ClearMutex:      &sync.RWMutex{},
+		timer:           time.NewTimer(TIMER_DURATION),
+		done:            make(chan struct{}),
+		closeOnce:       &sync.Once{},
+	}
+
+	leasedLimitUseCase.triggerReleaseRoutine(context.Background())
+
+	return leasedLimitUseCase
+}
+
+func (l *LeasedLimitUseCase) triggerReleaseRoutine(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-l.timer.C:
+				l.ClearMutex.Lock()
+				l.releaseLeases(ctx, false)
+				l.ClearMutex.Unlock()
+
+				l.timer.Reset(TIMER_DURATION)
+			}
+		}
+	}()
+}
+
+// releaseLeases devolve as fatias ociosas, ou todas quando all é verdadeiro, e tira do
+// cache o que não serve mais. Precisa do ClearMutex travado.
+func (l *LeasedLimitUseCase) releaseLeases(ctx context.Context, all bool) {
+	now := time.Now()
+
+	for key, lease := range l.Leases {
+		blocked := lease.FreeAt != nil && !lease.FreeAt.Before(now)
+		expired := !now.Before(lease.WindowEnd)
+		idle := now.Sub(lease.LastUsedAt) >= TIMER_DURATION
+
+		if blocked && !all {
+			continue
+		}
+
+		if !expired && !idle && !all {
+			continue
+		}
+
+		if !expired && lease.Remaining > 0 {
+			if err := l.LimitRepository.ReleaseQuota(ctx, key, lease.WindowStart, lease.Remaining); err != nil {
+				fmt.Printf("Erro ao devolver a cota da chave %s\n", key)
+			}
+		}
+
+		delete(l.Leases, key)
+	}
+}
+
+// Close para a rotina de devolução e devolve tudo o que ainda não foi gasto
+func (l *LeasedLimitUseCase) Close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.timer.Stop()
+
+		l.ClearMutex.Lock()
+		defer l.ClearMutex.Unlock()
+
+		l.releaseLeases(context.Background(), true)
+	})
+}
+
+func (l *LeasedLimitUseCase) Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error) {
+	if !IsValidLimitAlgorithm(input.Algorithm) {
+		return LimitOutputDTO{Pass: false}, fmt.Errorf("unknown limit algorithm: %s", input.Algorithm)
+	}
+
+	if normalizeLimitAlgorithm(input.Algorithm) != AlgorithmFixedWindow {
+		return LimitOutputDTO{Pass: false}, errors.New("quota leasing only supports the fixed_window algorithm")
+	}
+
+	if err := validateBlockPolicy(input.BlockPolicy); err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	tiers, err := resolveTiers(input)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
+
+	l.ClearMutex.RLock()
+	defer l.ClearMutex.RUnlock()
+
+	leases := make([]*quotaLease, len(tiers))
+	for i, tier := range tiers {
+		leases[i] = l.cachedLease(tier.Input.Id)
+	}
+
+	// Trava todos os tiers da chave, sempre na mesma ordem para não haver deadlock
+	lockOrder := make([]int, len(tiers))
+	for i := range lockOrder {
+		lockOrder[i] = i
+	}
+	sort.Slice(lockOrder, func(a, b int) bool {
+		return tiers[lockOrder[a]].Input.Id < tiers[lockOrder[b]].Input.Id
+	})
+	for _, i := range lockOrder {
+		leases[i].Mutex.Lock()
+		defer leases[i].Mutex.Unlock()
+	}
+
+	// Primeiro garante cota em todos os tiers, só depois consome
+	for i, tier := range tiers {
+		now := time.Now()
+		lease := leases[i]
+
+		if lease.FreeAt != nil && !lease.FreeAt.Before(now) {
+			return deniedLeaseOutput(tier, lease, lease.FreeAt.Sub(now)), nil
+		}
+
+		inWindow := now.Before(lease.WindowEnd)
+		if inWindow && lease.Remaining > 0 {
+			continue
+		}
+
+		// A janela esgotou para todas as instâncias, não adianta perguntar de novo
+		if inWindow && lease.Exhausted {
+			return deniedLeaseOutput(tier, lease, lease.WindowEnd.Sub(now)), nil
+		}
+
+		if err := l.renewLease(ctx, lease, tier.Input); err != nil {
+			return LimitOutputDTO{Pass: false}, err
+		}
+
+		if lease.FreeAt != nil {
+			return deniedLeaseOutput(tier, lease, lease.FreeAt.Sub(now)), nil
+		}
+
+		if lease.Remaining == 0 {
+			return deniedLeaseOutput(tier, lease, lease.WindowEnd.Sub(now)), nil
+		}
+	}
+
+	var output LimitOutputDTO
+
+	now := time.Now()
+	for i, lease := range leases {
+		lease.Remaining--
+		lease.LastUsedAt = now
+
+		// O restante é aproximado, as outras instâncias podem ter pego fatias depois
+		remaining := lease.Remaining + lease.Available
+		if i == 0 || remaining < output.Remaining {
+			output = LimitOutputDTO{
+				Limit:        tiers[i].Input.MaxReqs,
+				Remaining:    remaining,
+				Reset:        lease.WindowEnd.Sub(now),
+				OffenseLevel: lease.OffenseLevel,
+			}
+		}
+	}
+	output.Pass = true
+
+	return output, nil
+}
+
+func deniedLeaseOutput(tier limitTier, lease *quotaLease, retryAfter time.Duration) LimitOutputDTO {
+	return LimitOutputDTO{
+		Pass:         false,
+		Limit:        tier.Input.MaxReqs,
+		Remaining:    0,
+		Reset:        retryAfter,
+		RetryAfter:   retryAfter,
+		Tier:         tier.Name,
+		OffenseLevel: lease.OffenseLevel,
+	}
+}
+
+// cachedLease busca a fatia da chave no cache, criando uma vazia se ainda não existir
+func (l *LeasedLimitUseCase) cachedLease(id string) *quotaLease {
+	l.UseCaseMutex.Lock()
+	defer l.UseCaseMutex.Unlock()
+
+	lease, ok := l.Leases[id]
+	if !ok {
+		lease = &quotaLease{
+			Mutex: &sync.Mutex{},
+		}
+		l.Leases[id] = lease
+	}
+
+	return lease
+}
+
+// renewLease pede uma nova fatia ao repositório. O que sobrou da anterior é de uma
+// janela que já acabou, então não precisa ser devolvido.
+func (l *LeasedLimitUseCase) renewLease(ctx context.Context, lease *quotaLease, input LimitInputDTO) error {
+	acquired, err := l.LimitRepository.AcquireQuota(ctx, limit_entity.QuotaLeaseRule{
+		Key:          input.Id,
+		MaxReqs:      input.MaxReqs,
+		Window:       windowOf(input),
+		LeaseSize:    l.leaseSize(input.MaxReqs),
+		BlockTime:    time.Duration(input.BlockTimeBySec) * time.Second,
+		MaxBlockTime: MAX_BLOCK_DURATION,
+		PenaltyDecay: input.PenaltyDecay,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLimitBackend, err)
+	}
+
+	lease.Remaining = acquired.Granted
+	lease.Available = acquired.Available
+	lease.WindowStart = acquired.WindowStart
+	lease.WindowEnd = acquired.WindowEnd
+	lease.FreeAt = acquired.FreeAt
+	lease.Exhausted = acquired.Granted == 0
+	lease.OffenseLevel = acquired.OffenseLevel
+
+	return nil
+}
+
+func (l *LeasedLimitUseCase) leaseSize(maxReqs int32) int32 {
+	return max(1, int32(math.Ceil(float64(maxReqs)*l.LeaseFraction)))
+}
@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/redis/limit"
+)
+
+type LeasedLimitUseCaseRedisTestSuite struct {
+	suite.Suite
+	LimitRepository *limit.RedisLimitRepository
+	Sut             *LeasedLimitUseCase
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) SetupTest() {
+	LimitRepository := limit.NewRedisLimitRepository("localhost", "6379")
+	suite.Sut = NewLeasedLimitUseCase(LimitRepository, DEFAULT_LEASE_FRACTION)
+	suite.LimitRepository = LimitRepository
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TearDownTest() {
+	suite.Sut.Close()
+
+	err := suite.LimitRepository.Rdb.FlushDB(context.Background()).Err()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TearDownSuite() {
+	suite.LimitRepository.Rdb.Close()
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TestLeasedLimitUseCase_Should_pass_one_single_request() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+	})
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TestLeasedLimitUseCase_Should_block_key_for_all_instances() {
+	other := NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+	defer other.Close()
+
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 1,
+		Window:         time.Minute,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	output, err = other.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = other.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TestLeasedLimitUseCase_Should_return_unused_quota_on_close() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Hour,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	suite.Sut.Close()
+
+	other := NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+	defer other.Close()
+
+	passed := 0
+	for range 60 {
+		output, err := other.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		if output.Pass {
+			passed++
+		}
+	}
+	suite.Equal(49, passed)
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TestLeasedLimitUseCase_Should_not_exceed_global_limit_across_instances() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Hour,
+	}
+
+	instances := make([]*LeasedLimitUseCase, 5)
+	for i := range instances {
+		repository := limit.NewRedisLimitRepository("localhost", "6379")
+		defer repository.Rdb.Close()
+		instances[i] = NewLeasedLimitUseCase(repository, DEFAULT_LEASE_FRACTION)
+		defer instances[i].Close()
+	}
+
+	var passed atomic.Int32
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		for range 40 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				output, err := instance.Execute(context.Background(), limitInput)
+				suite.Nil(err)
+				if output.Pass {
+					passed.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	suite.LessOrEqual(passed.Load(), limitInput.MaxReqs+suite.Sut.leaseSize(limitInput.MaxReqs))
+}
+
+func (suite *LeasedLimitUseCaseRedisTestSuite) TestLeasedLimitUseCase_Should_penalize_repeat_offenders() {
+	runLimiterCases(&suite.Suite, suite.Sut, penaltyCases)
+}
+
+func TestLeasedLimitUseCaseRedisTestSuite(t *testing.T) {
+	suite.Run(t, new(LeasedLimitUseCaseRedisTestSuite))
+}
@@ -0,0 +1,260 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+)
+
+type LeasedLimitUseCaseTestSuite struct {
+	suite.Suite
+	LimitRepository *limit.InMemoryLimitRepository
+	Sut             *LeasedLimitUseCase
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) SetupTest() {
+	LimitRepository := limit.NewInMemoryLimitRepository()
+	suite.Sut = NewLeasedLimitUseCase(LimitRepository, DEFAULT_LEASE_FRACTION)
+	suite.LimitRepository = LimitRepository
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TearDownTest() {
+	suite.Sut.Close()
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_pass_one_single_request() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+	})
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_return_error_when_algorithm_is_not_fixed_window() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmTokenBucket,
+	})
+	suite.NotNil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_lease_a_slice_of_the_limit() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Minute,
+	})
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	// 20% de 50, uma já foi gasta
+	suite.Equal(int32(9), suite.Sut.Leases["IP"].Remaining)
+	suite.Equal(int32(10), suite.LimitRepository.Db["lease:IP"].Counter)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_deny_when_window_is_exhausted_and_pass_on_next_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 0,
+	}
+
+	// Garante que as requisições caiam na mesma janela de um segundo
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	for range 5 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Greater(output.RetryAfter, time.Duration(0))
+
+	time.Sleep(output.RetryAfter)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_block_key_for_all_instances() {
+	other := NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+	defer other.Close()
+
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 1,
+		Window:         time.Minute,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(time.Second, output.RetryAfter.Round(100*time.Millisecond))
+
+	// A outra instância também vê o bloqueio
+	output, err = other.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = other.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_return_unused_quota_on_close() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Hour,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	suite.Sut.Close()
+	suite.Equal(int32(1), suite.LimitRepository.Db["lease:IP"].Counter)
+
+	// Sem a devolução a outra instância só conseguiria 40
+	other := NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+	defer other.Close()
+
+	passed := 0
+	for range 60 {
+		output, err := other.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		if output.Pass {
+			passed++
+		}
+	}
+	suite.Equal(49, passed)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_report_denied_tier_and_not_consume_other_tiers() {
+	limitInput := LimitInputDTO{
+		Id: "IP",
+		Tiers: []LimitTierDTO{
+			{Name: "hour", MaxReqs: 2, Window: time.Hour},
+			{Name: "day", MaxReqs: 10, Window: 24 * time.Hour},
+		},
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal("hour", output.Tier)
+
+	// O tier de dia recebeu uma fatia de 2 e gastou as duas
+	suite.Equal(int32(0), suite.Sut.Leases["IP:day"].Remaining)
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_not_exceed_global_limit_by_more_than_lease_size_across_instances() {
+	const instancesCount = 5
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Second,
+	}
+	leaseSize := suite.Sut.leaseSize(limitInput.MaxReqs)
+
+	instances := make([]*LeasedLimitUseCase, instancesCount)
+	for i := range instances {
+		instances[i] = NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+		defer instances[i].Close()
+	}
+
+	// Começa no início de uma janela para ter três janelas inteiras
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	passedByWindow := make(map[int64]*atomic.Int32)
+	for w := range int64(4) {
+		passedByWindow[time.Now().Truncate(time.Second).Unix()+w] = &atomic.Int32{}
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for time.Now().Before(deadline) {
+					output, err := instance.Execute(context.Background(), limitInput)
+					suite.Nil(err)
+					if output.Pass {
+						passedByWindow[time.Now().Truncate(time.Second).Unix()].Add(1)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, passed := range passedByWindow {
+		suite.LessOrEqual(passed.Load(), limitInput.MaxReqs+leaseSize)
+	}
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_report_limit_remaining_and_reset() {
+	other := NewLeasedLimitUseCase(suite.LimitRepository, DEFAULT_LEASE_FRACTION)
+	defer other.Close()
+
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        50,
+		BlockTimeBySec: 0,
+		Window:         time.Hour,
+	}
+
+	output, err := other.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	// A fatia da outra instância já foi descontada
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(50), output.Limit)
+	suite.Equal(int32(39), output.Remaining)
+	suite.InDelta(time.Until(time.Now().Truncate(time.Hour).Add(time.Hour)), output.Reset, float64(time.Second))
+}
+
+func (suite *LeasedLimitUseCaseTestSuite) TestLeasedLimitUseCase_Should_penalize_repeat_offenders() {
+	runLimiterCases(&suite.Suite, suite.Sut, penaltyCases)
+}
+
+func TestLeasedLimitUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(LeasedLimitUseCaseTestSuite))
+}
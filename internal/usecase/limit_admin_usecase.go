@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+var ErrLimitNotFound = errors.New("limit not found")
+
+// LimitCache é o cache local de uma strategy, que precisa ser consultado e invalidado
+// quando a administração mexe em um limit
+type LimitCache interface {
+	CachedLimit(id string) (*limit_entity.Limit, bool)
+	InvalidateLimit(id string, update func(cached *limit_entity.Limit) error) error
+}
+
+type LimitStateOutputDTO struct {
+	Id          string     `json:"id"`
+	Blocked     bool       `json:"blocked"`
+	FreeAt      *time.Time `json:"free_at,omitempty"`
+	LastAt      time.Time  `json:"last_at"`
+	Counter     int32      `json:"counter"`
+	Timestamps  int        `json:"timestamps"`
+	Tokens      float64    `json:"tokens"`
+	WindowStart time.Time  `json:"window_start"`
+	PrevCounter int32      `json:"prev_counter"`
+	Offenses    int32      `json:"offenses"`
+	OffenseAt   *time.Time `json:"offense_at,omitempty"`
+}
+
+type LimitListOutputDTO struct {
+	Ids    []string `json:"ids"`
+	Cursor uint64   `json:"cursor"`
+}
+
+// LimitAdminUseCase permite ver, zerar, desbloquear e bloquear uma chave. O id é o mesmo
+// usado pelo middleware, com o sufixo do tier quando houver, ex: token:abc:minute.
+type LimitAdminUseCase struct {
+	LimitRepository limit_entity.LimitEntityRepository
+	LimitCache      LimitCache
+}
+
+// NewLimitAdminUseCase recebe cache nil quando a strategy decide direto no repository
+func NewLimitAdminUseCase(LimitRepository limit_entity.LimitEntityRepository, LimitCache LimitCache) *LimitAdminUseCase {
+	return &LimitAdminUseCase{
+		LimitRepository: LimitRepository,
+		LimitCache:      LimitCache,
+	}
+}
+
+func (a *LimitAdminUseCase) GetLimit(ctx context.Context, id string) (LimitStateOutputDTO, error) {
+	limit, err := a.currentLimit(ctx, id)
+	if err != nil {
+		return LimitStateOutputDTO{}, err
+	}
+
+	if limit == nil {
+		return LimitStateOutputDTO{}, ErrLimitNotFound
+	}
+
+	return limitState(limit, time.Now()), nil
+}
+
+func (a *LimitAdminUseCase) ListLimits(ctx context.Context, cursor uint64, count int64) (LimitListOutputDTO, error) {
+	ids, next, err := a.LimitRepository.ListLimitIds(ctx, cursor, count)
+	if err != nil {
+		return LimitListOutputDTO{}, err
+	}
+
+	return LimitListOutputDTO{Ids: ids, Cursor: next}, nil
+}
+
+// ResetLimit apaga o estado da chave, a próxima requisição começa do zero
+func (a *LimitAdminUseCase) ResetLimit(ctx context.Context, id string) error {
+	return a.update(ctx, id, func(limit *limit_entity.Limit) error {
+		return a.LimitRepository.DeleteLimitById(ctx, id)
+	})
+}
+
+// UnblockLimit tira o bloqueio e zera o estado do algoritmo, como acontece quando o bloqueio
+// vence sozinho. A penalidade progressiva continua, só ResetLimit a apaga.
+func (a *LimitAdminUseCase) UnblockLimit(ctx context.Context, id string) error {
+	return a.update(ctx, id, func(limit *limit_entity.Limit) error {
+		if limit == nil {
+			return ErrLimitNotFound
+		}
+
+		return a.LimitRepository.UpdateLimitById(ctx, id, &limit_entity.Limit{
+			Id:        id,
+			LastAt:    limit.LastAt,
+			Offenses:  limit.Offenses,
+			OffenseAt: limit.OffenseAt,
+			ExpiresAt: limit.ExpiresAt,
+		})
+	})
+}
+
+// BlockLimit bloqueia a chave por duration. Requisições durante o bloqueio não o encurtam.
+// O bloqueio manual não conta como infração, o nível de penalidade fica como estava.
+func (a *LimitAdminUseCase) BlockLimit(ctx context.Context, id string, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.New("block duration must be greater than zero")
+	}
+
+	return a.update(ctx, id, func(limit *limit_entity.Limit) error {
+		now := time.Now()
+		freeAt := now.Add(duration)
+		blocked := &limit_entity.Limit{
+			Id:        id,
+			FreeAt:    &freeAt,
+			LastAt:    now,
+			Counter:   1,
+			ExpiresAt: freeAt,
+		}
+
+		if limit == nil {
+			return a.LimitRepository.CreateLimit(ctx, blocked)
+		}
+
+		blocked.Offenses = limit.Offenses
+		blocked.OffenseAt = limit.OffenseAt
+		if limit.ExpiresAt.After(freeAt) {
+			blocked.ExpiresAt = limit.ExpiresAt
+		}
+
+		return a.LimitRepository.UpdateLimitById(ctx, id, blocked)
+	})
+}
+
+// currentLimit prefere o cache, que pode ainda não ter sido gravado no repository
+func (a *LimitAdminUseCase) currentLimit(ctx context.Context, id string) (*limit_entity.Limit, error) {
+	if a.LimitCache != nil {
+		if limit, ok := a.LimitCache.CachedLimit(id); ok {
+			return limit, nil
+		}
+	}
+
+	return a.LimitRepository.GetLimitById(ctx, id)
+}
+
+// update entrega a fn o estado atual da chave, nil se não existir, e invalida o cache
+func (a *LimitAdminUseCase) update(ctx context.Context, id string, fn func(limit *limit_entity.Limit) error) error {
+	fromRepository := func(cached *limit_entity.Limit) error {
+		if cached != nil {
+			return fn(cached)
+		}
+
+		limit, err := a.LimitRepository.GetLimitById(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return fn(limit)
+	}
+
+	if a.LimitCache == nil {
+		return fromRepository(nil)
+	}
+
+	return a.LimitCache.InvalidateLimit(id, fromRepository)
+}
+
+func limitState(limit *limit_entity.Limit, now time.Time) LimitStateOutputDTO {
+	var offenseAt *time.Time
+	if !limit.OffenseAt.IsZero() {
+		offenseAt = &limit.OffenseAt
+	}
+
+	return LimitStateOutputDTO{
+		Id:          limit.Id,
+		Blocked:     limit.FreeAt != nil && !limit.FreeAt.Before(now),
+		FreeAt:      limit.FreeAt,
+		LastAt:      limit.LastAt,
+		Counter:     limit.Counter,
+		Timestamps:  len(limit.Timestamps),
+		Tokens:      limit.Tokens,
+		WindowStart: limit.WindowStart,
+		PrevCounter: limit.PrevCounter,
+		Offenses:    limit.Offenses,
+		OffenseAt:   offenseAt,
+	}
+}
@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/infra/database/in_memory/limit"
+)
+
+type LimitAdminUseCaseTestSuite struct {
+	suite.Suite
+	LimitRepository *limit.InMemoryLimitRepository
+	LimitUseCase    *LimitUseCase
+	Sut             *LimitAdminUseCase
+}
+
+func (suite *LimitAdminUseCaseTestSuite) SetupTest() {
+	LimitRepository := limit.NewInMemoryLimitRepository()
+	suite.LimitUseCase = NewLimitUseCase(LimitRepository)
+	suite.Sut = NewLimitAdminUseCase(LimitRepository, suite.LimitUseCase)
+	suite.LimitRepository = LimitRepository
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TearDownTest() {
+	suite.LimitUseCase.Close()
+}
+
+func (suite *LimitAdminUseCaseTestSuite) block(limitInput LimitInputDTO) {
+	for range limitInput.MaxReqs + 1 {
+		_, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+	}
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_return_not_found_when_limit_does_not_exist() {
+	_, err := suite.Sut.GetLimit(context.Background(), "IP")
+	suite.ErrorIs(err, ErrLimitNotFound)
+
+	err = suite.Sut.UnblockLimit(context.Background(), "IP")
+	suite.ErrorIs(err, ErrLimitNotFound)
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_get_the_cached_state() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 5, BlockTimeBySec: 5}
+
+	for range 3 {
+		_, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+	}
+
+	// O repository ainda tem o estado da primeira requisição, o cache tem o das três
+	output, err := suite.Sut.GetLimit(context.Background(), "IP")
+	suite.Nil(err)
+	suite.Equal("IP", output.Id)
+	suite.False(output.Blocked)
+	suite.Equal(int32(3), output.Counter)
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_reset_a_blocked_limit() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 2, BlockTimeBySec: 60}
+	suite.block(limitInput)
+
+	output, err := suite.Sut.GetLimit(context.Background(), "IP")
+	suite.Nil(err)
+	suite.True(output.Blocked)
+
+	err = suite.Sut.ResetLimit(context.Background(), "IP")
+	suite.Nil(err)
+
+	_, err = suite.Sut.GetLimit(context.Background(), "IP")
+	suite.ErrorIs(err, ErrLimitNotFound)
+
+	result, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(result.Pass)
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_unblock_a_blocked_limit() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 2, BlockTimeBySec: 60}
+	suite.block(limitInput)
+
+	err := suite.Sut.UnblockLimit(context.Background(), "IP")
+	suite.Nil(err)
+
+	output, err := suite.Sut.GetLimit(context.Background(), "IP")
+	suite.Nil(err)
+	suite.False(output.Blocked)
+	suite.Nil(output.FreeAt)
+
+	for range 2 {
+		result, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(result.Pass)
+	}
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_block_without_being_shortened_by_requests() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 5, BlockTimeBySec: 1}
+
+	_, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+
+	err = suite.Sut.BlockLimit(context.Background(), "IP", time.Hour)
+	suite.Nil(err)
+
+	for range 2 {
+		result, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.False(result.Pass)
+		suite.Greater(result.RetryAfter, 59*time.Minute)
+	}
+
+	err = suite.Sut.BlockLimit(context.Background(), "other", time.Hour)
+	suite.Nil(err)
+
+	result, err := suite.LimitUseCase.Execute(context.Background(), LimitInputDTO{Id: "other", MaxReqs: 5, BlockTimeBySec: 1})
+	suite.Nil(err)
+	suite.False(result.Pass)
+
+	err = suite.Sut.BlockLimit(context.Background(), "IP", 0)
+	suite.NotNil(err)
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_list_all_limit_ids() {
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := suite.LimitUseCase.Execute(context.Background(), LimitInputDTO{Id: id, MaxReqs: 5, BlockTimeBySec: 5})
+		suite.Nil(err)
+	}
+
+	var ids []string
+	var cursor uint64
+	for {
+		output, err := suite.Sut.ListLimits(context.Background(), cursor, 2)
+		suite.Nil(err)
+
+		ids = append(ids, output.Ids...)
+		cursor = output.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	suite.ElementsMatch([]string{"a", "b", "c"}, ids)
+}
+
+func (suite *LimitAdminUseCaseTestSuite) TestLimitAdminUseCase_Should_keep_offenses_on_unblock_and_forget_them_on_reset() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 1, BlockTimeBySec: 60, PenaltyDecay: time.Hour}
+	suite.block(limitInput)
+
+	err := suite.Sut.UnblockLimit(context.Background(), "IP")
+	suite.Nil(err)
+
+	output, err := suite.Sut.GetLimit(context.Background(), "IP")
+	suite.Nil(err)
+	suite.False(output.Blocked)
+	suite.Equal(int32(1), output.Offenses)
+	suite.NotNil(output.OffenseAt)
+
+	// Depois do desbloqueio o próximo bloqueio já é do nível dois
+	result, err := suite.LimitUseCase.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(result.Pass)
+
+	result, err = suite.LimitUseCase.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(result.Pass)
+	suite.Equal(int32(2), result.OffenseLevel)
+	suite.InDelta(6*time.Minute, result.RetryAfter, float64(time.Second))
+
+	err = suite.Sut.ResetLimit(context.Background(), "IP")
+	suite.Nil(err)
+
+	suite.block(limitInput)
+
+	output, err = suite.Sut.GetLimit(context.Background(), "IP")
+	suite.Nil(err)
+	suite.True(output.Blocked)
+	suite.Equal(int32(1), output.Offenses)
+}
+
+func TestLimitAdminUseCaseTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitAdminUseCaseTestSuite))
+}
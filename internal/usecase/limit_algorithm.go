@@ -0,0 +1,316 @@
+package usecase
+
+import (
+	"math"
+	"time"
+
+	"github.com/HalexV/pos-go-expert-desafio-rate-limiter/internal/entity/limit_entity"
+)
+
+type LimitAlgorithm string
+
+const (
+	AlgorithmFixedWindow          LimitAlgorithm = "fixed_window"
+	AlgorithmSlidingWindowLog     LimitAlgorithm = "sliding_window_log"
+	AlgorithmTokenBucket          LimitAlgorithm = "token_bucket"
+	AlgorithmSlidingWindowCounter LimitAlgorithm = "sliding_window_counter"
+)
+
+// Cada algoritmo avalia a requisição atual sobre o estado do limit e o atualiza
+// quando a requisição passa. Bloqueio e desbloqueio ficam a cargo do use case.
+type limitAlgorithmFunc func(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool
+
+var limitAlgorithms = map[LimitAlgorithm]limitAlgorithmFunc{
+	AlgorithmFixedWindow:          fixedWindow,
+	AlgorithmSlidingWindowLog:     slidingWindowLog,
+	AlgorithmTokenBucket:          tokenBucket,
+	AlgorithmSlidingWindowCounter: slidingWindowCounter,
+}
+
+// Sem algoritmo informado vale o fixed window, o comportamento original
+func normalizeLimitAlgorithm(algorithm LimitAlgorithm) LimitAlgorithm {
+	if algorithm == "" {
+		return AlgorithmFixedWindow
+	}
+
+	return algorithm
+}
+
+func limitAlgorithmFor(algorithm LimitAlgorithm) (limitAlgorithmFunc, bool) {
+	fn, ok := limitAlgorithms[normalizeLimitAlgorithm(algorithm)]
+	return fn, ok
+}
+
+// Cada status lê o estado já avaliado e informa Limit, Remaining, Reset e RetryAfter
+type limitStatusFunc func(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO
+
+var limitStatuses = map[LimitAlgorithm]limitStatusFunc{
+	AlgorithmFixedWindow:          fixedWindowStatus,
+	AlgorithmSlidingWindowLog:     slidingWindowLogStatus,
+	AlgorithmTokenBucket:          tokenBucketStatus,
+	AlgorithmSlidingWindowCounter: slidingWindowCounterStatus,
+}
+
+// limitStatus devolve o status do limit, que durante o bloqueio só libera em FreeAt
+func limitStatus(algorithm LimitAlgorithm, limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO {
+	status := limitStatuses[normalizeLimitAlgorithm(algorithm)](limit, input, now)
+
+	if limit.FreeAt != nil {
+		status.Remaining = 0
+		status.Reset = limit.FreeAt.Sub(now)
+		status.RetryAfter = status.Reset
+	}
+
+	status.OffenseLevel = limit_entity.OffenseLevel(limit.Offenses, limit.OffenseAt, now, input.PenaltyDecay)
+
+	return status
+}
+
+func IsValidLimitAlgorithm(algorithm LimitAlgorithm) bool {
+	_, ok := limitAlgorithmFor(algorithm)
+	return ok
+}
+
+// limitExpiresAt é quando o estado do limit deixa de influenciar qualquer decisão: o que vier
+// depois entre o fim do bloqueio, o fim da penalidade e o que o algoritmo ainda lembra
+func limitExpiresAt(algorithm LimitAlgorithm, limit *limit_entity.Limit, input LimitInputDTO) time.Time {
+	window := windowOf(input)
+
+	var expiresAt time.Time
+	switch normalizeLimitAlgorithm(algorithm) {
+	case AlgorithmTokenBucket:
+		// Tempo para o balde vazio encher de novo
+		capacity := input.Burst
+		if capacity <= 0 {
+			capacity = input.MaxReqs
+		}
+		expiresAt = limit.LastAt.Add(window * time.Duration(capacity) / time.Duration(max(1, input.MaxReqs)))
+	case AlgorithmSlidingWindowCounter:
+		// A janela atual ainda pesa na seguinte, como anterior
+		expiresAt = limit.WindowStart.Add(2 * window)
+	default:
+		expiresAt = limit.LastAt.Add(window)
+	}
+
+	if limit.FreeAt != nil && limit.FreeAt.After(expiresAt) {
+		expiresAt = *limit.FreeAt
+	}
+
+	if limit.Offenses > 0 {
+		if offenseEnd := limit.OffenseAt.Add(input.PenaltyDecay); offenseEnd.After(expiresAt) {
+			expiresAt = offenseEnd
+		}
+	}
+
+	return expiresAt
+}
+
+func windowOf(input LimitInputDTO) time.Duration {
+	if input.Window <= 0 {
+		return time.Second
+	}
+
+	return input.Window
+}
+
+func fixedWindow(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool {
+	// Passou uma janela sem requisição
+	if now.Sub(limit.LastAt) > windowOf(input) {
+		limit.LastAt = now
+		limit.Counter = 1
+		return true
+	}
+
+	// Atingiu o máximo de requisições da janela
+	if limit.Counter+1 > input.MaxReqs {
+		return false
+	}
+
+	// Incrementa o counter e ok
+	limit.LastAt = now
+	limit.Counter++
+	return true
+}
+
+func slidingWindowLog(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool {
+	windowStart := now.Add(-windowOf(input))
+
+	// Descarta os timestamps que já saíram da janela
+	timestamps := make([]time.Time, 0, len(limit.Timestamps)+1)
+	for _, t := range limit.Timestamps {
+		if t.After(windowStart) {
+			timestamps = append(timestamps, t)
+		}
+	}
+
+	limit.Timestamps = timestamps
+	limit.Counter = int32(len(timestamps))
+
+	if limit.Counter >= input.MaxReqs {
+		return false
+	}
+
+	limit.Timestamps = append(limit.Timestamps, now)
+	limit.LastAt = now
+	limit.Counter++
+	return true
+}
+
+func fixedWindowStatus(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO {
+	// O counter zera uma janela depois da última requisição
+	reset := max(0, limit.LastAt.Add(windowOf(input)).Sub(now))
+
+	status := LimitOutputDTO{
+		Limit:     input.MaxReqs,
+		Remaining: max(0, input.MaxReqs-limit.Counter),
+		Reset:     reset,
+	}
+	if status.Remaining == 0 {
+		status.RetryAfter = reset
+	}
+
+	return status
+}
+
+func slidingWindowLogStatus(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO {
+	window := windowOf(input)
+	count := int32(len(limit.Timestamps))
+
+	status := LimitOutputDTO{
+		Limit:     input.MaxReqs,
+		Remaining: max(0, input.MaxReqs-count),
+	}
+
+	if count > 0 {
+		// O limite está inteiro quando o timestamp mais novo sai da janela
+		status.Reset = max(0, limit.Timestamps[count-1].Add(window).Sub(now))
+	}
+
+	if status.Remaining == 0 && count > 0 {
+		// Passa quando sair da janela o suficiente para caber mais uma
+		oldest := limit.Timestamps[max(0, count-input.MaxReqs)]
+		status.RetryAfter = max(0, oldest.Add(window).Sub(now))
+	}
+
+	return status
+}
+
+// No token bucket MaxReqs por Window é a taxa de reposição e Burst a capacidade do balde
+func tokenBucket(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool {
+	capacity := float64(input.Burst)
+	if capacity <= 0 {
+		capacity = float64(input.MaxReqs)
+	}
+
+	// Primeira requisição, o balde começa cheio
+	if limit.LastAt.IsZero() {
+		limit.Tokens = capacity
+	} else {
+		refill := float64(now.Sub(limit.LastAt)) / float64(windowOf(input)) * float64(input.MaxReqs)
+		limit.Tokens = min(capacity, limit.Tokens+refill)
+	}
+	limit.LastAt = now
+
+	if limit.Tokens < 1 {
+		return false
+	}
+
+	limit.Tokens--
+	limit.Counter = int32(capacity - limit.Tokens)
+	return true
+}
+
+func tokenBucketStatus(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO {
+	capacity := input.Burst
+	if capacity <= 0 {
+		capacity = input.MaxReqs
+	}
+
+	// Tempo para repor um token
+	perToken := float64(windowOf(input)) / float64(max(1, input.MaxReqs))
+
+	tokens := limit.Tokens
+	if limit.LastAt.IsZero() {
+		tokens = float64(capacity)
+	}
+
+	status := LimitOutputDTO{
+		Limit:     capacity,
+		Remaining: int32(math.Floor(max(0, tokens))),
+		Reset:     time.Duration((float64(capacity) - tokens) * perToken),
+	}
+	if tokens < 1 {
+		status.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+
+	return status
+}
+
+// O sliding window counter guarda só a contagem da janela anterior e da atual e
+// estima as requisições da janela deslizante ponderando a anterior pelo quanto
+// dela ainda se sobrepõe
+func slidingWindowCounter(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool {
+	window := windowOf(input)
+
+	currentStart := now.Truncate(window)
+	switch currentStart.Sub(limit.WindowStart) {
+	case 0:
+		// Mesma janela
+	case window:
+		// A janela atual virou a anterior
+		limit.PrevCounter = limit.Counter
+		limit.Counter = 0
+	default:
+		// Passou mais de uma janela sem requisição
+		limit.PrevCounter = 0
+		limit.Counter = 0
+	}
+	limit.WindowStart = currentStart
+
+	prevWeight := 1 - float64(now.Sub(currentStart))/float64(window)
+	estimated := float64(limit.PrevCounter)*prevWeight + float64(limit.Counter)
+
+	if estimated+1 > float64(input.MaxReqs) {
+		return false
+	}
+
+	limit.LastAt = now
+	limit.Counter++
+	return true
+}
+
+func slidingWindowCounterStatus(limit *limit_entity.Limit, input LimitInputDTO, now time.Time) LimitOutputDTO {
+	window := windowOf(input)
+	windowEnd := limit.WindowStart.Add(window)
+
+	prevWeight := 1 - float64(now.Sub(limit.WindowStart))/float64(window)
+	estimated := float64(limit.PrevCounter)*prevWeight + float64(limit.Counter)
+
+	status := LimitOutputDTO{
+		Limit:     input.MaxReqs,
+		Remaining: int32(math.Floor(max(0, float64(input.MaxReqs)-estimated))),
+		Reset:     max(0, windowEnd.Sub(now)),
+	}
+
+	if status.Remaining > 0 {
+		return status
+	}
+
+	// Espaço que a janela anterior precisa deixar para caber mais uma
+	room := float64(input.MaxReqs - 1 - limit.Counter)
+
+	var freeAt time.Time
+	switch {
+	case room >= 0 && limit.PrevCounter > 0:
+		freeAt = limit.WindowStart.Add(time.Duration(float64(window) * (1 - room/float64(limit.PrevCounter))))
+	case room >= 0:
+		freeAt = now
+	default:
+		// Só na próxima janela, quando a atual passar a ser a anterior
+		fraction := min(1, 1-float64(input.MaxReqs-1)/float64(limit.Counter))
+		freeAt = windowEnd.Add(time.Duration(float64(window) * fraction))
+	}
+	status.RetryAfter = max(0, freeAt.Sub(now))
+
+	return status
+}
@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LimitTierDTO é um dos limites empilhados sobre a mesma chave, ex: 10/s, 300/min e 10000/dia
+type LimitTierDTO struct {
+	Name           string
+	MaxReqs        int32
+	Window         time.Duration
+	BlockTimeBySec int32
+	Burst          int32
+}
+
+type limitTier struct {
+	Name  string
+	Input LimitInputDTO
+}
+
+// Cada tier tem o seu próprio contador, guardado em uma chave derivada do id
+func tierKey(id string, name string) string {
+	if name == "" {
+		return id
+	}
+
+	return id + ":" + name
+}
+
+// resolveTiers devolve os limites a avaliar. Sem Tiers o próprio input é o único limite.
+func resolveTiers(input LimitInputDTO) ([]limitTier, error) {
+	if len(input.Tiers) == 0 {
+		return []limitTier{{Input: input}}, nil
+	}
+
+	tiers := make([]limitTier, 0, len(input.Tiers))
+	names := make(map[string]bool, len(input.Tiers))
+
+	for _, tier := range input.Tiers {
+		if tier.Name == "" {
+			return nil, errors.New("tier name is required")
+		}
+
+		if names[tier.Name] {
+			return nil, fmt.Errorf("duplicated tier name: %s", tier.Name)
+		}
+		names[tier.Name] = true
+
+		tiers = append(tiers, limitTier{
+			Name: tier.Name,
+			Input: LimitInputDTO{
+				Id:             tierKey(input.Id, tier.Name),
+				MaxReqs:        tier.MaxReqs,
+				BlockTimeBySec: tier.BlockTimeBySec,
+				Algorithm:      input.Algorithm,
+				Burst:          tier.Burst,
+				Window:         tier.Window,
+				BlockPolicy:    input.BlockPolicy,
+				PenaltyDecay:   input.PenaltyDecay,
+			},
+		})
+	}
+
+	return tiers, nil
+}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,12 +12,33 @@ import (
 
 type LimitInputDTO struct {
 	Id             string
-	ReqsBySec      int32
+	MaxReqs        int32
 	BlockTimeBySec int32
+	Algorithm      LimitAlgorithm
+	Burst          int32
+	Window         time.Duration  // Janela em que MaxReqs é contado, zero equivale a um segundo
+	BlockPolicy    BlockPolicy    // O que uma requisição durante o bloqueio faz com ele, vale para todos os tiers
+	PenaltyDecay   time.Duration  // Sem nova infração nesse tempo a penalidade progressiva recomeça, zero a desliga
+	Tiers          []LimitTierDTO // Quando presente substitui MaxReqs, Window, BlockTimeBySec e Burst
 }
 
+// Limit, Remaining e Reset se referem ao tier que negou ou, quando a requisição passa,
+// ao tier com menos requisições restantes
 type LimitOutputDTO struct {
-	Pass bool
+	Pass       bool
+	Limit      int32         // Requisições permitidas pelo limite
+	Remaining  int32         // Requisições que ainda passam antes de negar
+	Reset      time.Duration // Tempo até o limite estar inteiro de novo
+	RetryAfter time.Duration // Tempo até uma requisição negada passar
+	Tier       string        // Tier que negou a requisição
+	// Nível da penalidade progressiva: quantos bloqueios seguidos a chave recebeu, zero sem
+	// penalidade em vigor
+	OffenseLevel int32
+}
+
+// Limiter é o contrato usado pelo middleware, cada estratégia de limite o implementa
+type Limiter interface {
+	Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error)
 }
 
 type MapLimitValue struct {
@@ -31,9 +53,10 @@ type LimitUseCase struct {
 	CacheLimit        map[string]*MapLimitValue
 	CacheLimitClearWG *sync.WaitGroup
 	UseCaseMutex      *sync.Mutex
-	UseCaseWG         *sync.WaitGroup
 	timer             *time.Timer
 	ClearMutex        *sync.RWMutex
+	done              chan struct{}
+	closeOnce         *sync.Once
 }
 
 func NewLimitUseCase(LimitRepository limit_entity.LimitEntityRepository) *LimitUseCase {
@@ -42,9 +65,10 @@ func NewLimitUseCase(LimitRepository limit_entity.LimitEntityRepository) *LimitU
 		CacheLimit:        make(map[string]*MapLimitValue),
 		CacheLimitClearWG: &sync.WaitGroup{},
 		UseCaseMutex:      &sync.Mutex{},
-		UseCaseWG:         &sync.WaitGroup{},
 		timer:             time.NewTimer(TIMER_DURATION),
 		ClearMutex:        &sync.RWMutex{},
+		done:              make(chan struct{}),
+		closeOnce:         &sync.Once{},
 	}
 
 	limitUseCase.triggerUpdateAndClearRoutine(context.Background())
@@ -57,11 +81,12 @@ func (l *LimitUseCase) triggerUpdateAndClearRoutine(ctx context.Context) {
 
 		for {
 			select {
+			case <-l.done:
+				return
 			case <-l.timer.C:
 				println("Ativei o clear")
-				// Espera todas as execuções que já começaram do execute terminem
-				l.UseCaseWG.Wait()
-
+				// O Lock espera todas as execuções que já começaram do execute terminem,
+				// cada uma segura o RLock até o fim
 				l.ClearMutex.Lock()
 				println("Verificando se o cache é zero")
 				if len(l.CacheLimit) == 0 {
@@ -76,12 +101,7 @@ func (l *LimitUseCase) triggerUpdateAndClearRoutine(ctx context.Context) {
 
 				l.ClearMutex.Lock()
 				println("Processando o cache")
-				for k, v := range l.CacheLimit {
-					if err := l.LimitRepository.UpdateLimitById(ctx, v.Data.Id, v.Data); err != nil {
-						fmt.Printf("Erro ao atualizar registro de ID %s\n", v.Data.Id)
-					}
-					delete(l.CacheLimit, k)
-				}
+				l.flushCache(ctx)
 				println("Terminou o processamento do cache")
 				l.ClearMutex.Unlock()
 
@@ -92,124 +112,268 @@ func (l *LimitUseCase) triggerUpdateAndClearRoutine(ctx context.Context) {
 	}()
 }
 
+// flushCache grava o cache no repository e o esvazia, precisa do ClearMutex travado
+// O estado gravado dura pelo menos mais um ciclo, senão o de uma janela que acabou antes da
+// gravação seria apagado sem nunca chegar ao repository
+func (l *LimitUseCase) flushCache(ctx context.Context) {
+	retainUntil := time.Now().Add(TIMER_DURATION)
+	for k, v := range l.CacheLimit {
+		if v.Data.ExpiresAt.Before(retainUntil) {
+			v.Data.ExpiresAt = retainUntil
+		}
+
+		if err := l.LimitRepository.UpdateLimitById(ctx, k, v.Data); err != nil {
+			fmt.Printf("Erro ao atualizar registro de ID %s\n", k)
+		}
+		delete(l.CacheLimit, k)
+	}
+}
+
+// Close para a rotina de atualização e grava no repository o que ainda está no cache
+func (l *LimitUseCase) Close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.timer.Stop()
+
+		l.ClearMutex.Lock()
+		defer l.ClearMutex.Unlock()
+
+		l.flushCache(context.Background())
+	})
+}
+
 func (l *LimitUseCase) Execute(ctx context.Context, input LimitInputDTO) (LimitOutputDTO, error) {
 	println("Execute: começou")
 	defer println("Execute: terminou")
-	l.ClearMutex.RLock()
-	defer l.ClearMutex.RUnlock()
 
-	// Comecei a executar
-	l.UseCaseWG.Add(1)
-	defer l.UseCaseWG.Done()
+	algorithm, ok := limitAlgorithmFor(input.Algorithm)
+	if !ok {
+		return LimitOutputDTO{Pass: false}, fmt.Errorf("unknown limit algorithm: %s", input.Algorithm)
+	}
 
-	// Trava por conta da hipótese do limit value não estar no cache
-	l.UseCaseMutex.Lock()
+	if err := validateBlockPolicy(input.BlockPolicy); err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
 
-	mapLimitValue, ok := l.CacheLimit[input.Id]
+	tiers, err := resolveTiers(input)
+	if err != nil {
+		return LimitOutputDTO{Pass: false}, err
+	}
 
-	// Não está no cache
-	if !ok {
-		limitData, err := l.LimitRepository.GetLimitById(ctx, input.Id)
+	l.ClearMutex.RLock()
+	defer l.ClearMutex.RUnlock()
+
+	mapLimitValues := make([]*MapLimitValue, len(tiers))
+	created := make([]bool, len(tiers))
+	for i, tier := range tiers {
+		mapLimitValue, isNew, err := l.cachedLimit(ctx, tier.Input.Id)
 		if err != nil {
-			l.UseCaseMutex.Unlock()
 			return LimitOutputDTO{Pass: false}, err
 		}
-		// Not found, create
-		if limitData == nil {
-			newLimitData := &limit_entity.Limit{
-				Id:      input.Id,
-				FreeAt:  nil,
-				LastAt:  time.Now(),
-				Counter: 1,
-			}
-			err = l.LimitRepository.CreateLimit(ctx, newLimitData)
-			if err != nil {
-				l.UseCaseMutex.Unlock()
-				return LimitOutputDTO{Pass: false}, err
-			}
-			l.CacheLimit[input.Id] = &MapLimitValue{
-				Data:  newLimitData,
-				Mutex: &sync.Mutex{},
+		mapLimitValues[i] = mapLimitValue
+		created[i] = isNew
+	}
+
+	// Trava todos os tiers da chave, sempre na mesma ordem para não haver deadlock
+	lockOrder := make([]int, len(tiers))
+	for i := range lockOrder {
+		lockOrder[i] = i
+	}
+	sort.Slice(lockOrder, func(a, b int) bool {
+		return tiers[lockOrder[a]].Input.Id < tiers[lockOrder[b]].Input.Id
+	})
+	for _, i := range lockOrder {
+		mapLimitValues[i].Mutex.Lock()
+		defer mapLimitValues[i].Mutex.Unlock()
+	}
+
+	var output LimitOutputDTO
+	pass := true
+
+	now := time.Now()
+	candidates := make([]*limit_entity.Limit, len(tiers))
+	for i, tier := range tiers {
+		candidate := mapLimitValues[i].Data.Clone()
+
+		allowed := l.evaluate(algorithm, candidate, tier.Input, now)
+		candidate.ExpiresAt = limitExpiresAt(tier.Input.Algorithm, candidate, tier.Input)
+
+		if !allowed {
+			// Só o tier que negou guarda o novo estado, os outros não contam a requisição
+			*mapLimitValues[i].Data = *candidate
+			output = limitStatus(tier.Input.Algorithm, candidate, tier.Input, now)
+			output.Tier = tier.Name
+			pass = false
+			break
+		}
+
+		candidates[i] = candidate
+	}
+
+	if pass {
+		for i, candidate := range candidates {
+			*mapLimitValues[i].Data = *candidate
+
+			// Reporta o tier mais perto de negar
+			status := limitStatus(tiers[i].Input.Algorithm, candidate, tiers[i].Input, now)
+			if i == 0 || status.Remaining < output.Remaining {
+				output = status
 			}
+		}
+		output.Pass = true
+	}
 
+	// Os limits novos são criados no repository já com o estado avaliado
+	for i, isNew := range created {
+		if !isNew {
+			continue
+		}
+
+		if err := l.LimitRepository.CreateLimit(ctx, mapLimitValues[i].Data); err != nil {
+			l.UseCaseMutex.Lock()
+			delete(l.CacheLimit, tiers[i].Input.Id)
 			l.UseCaseMutex.Unlock()
-			return LimitOutputDTO{Pass: true}, nil
+
+			return LimitOutputDTO{Pass: false}, fmt.Errorf("%w: %w", ErrLimitBackend, err)
 		}
+	}
+
+	return output, nil
+}
+
+// cachedLimit busca o limit no cache, depois no repository. Se não existir em nenhum
+// dos dois devolve um limit vazio já no cache, que ainda precisa ser criado no repository.
+func (l *LimitUseCase) cachedLimit(ctx context.Context, id string) (*MapLimitValue, bool, error) {
+	// Trava por conta da hipótese do limit value não estar no cache
+	l.UseCaseMutex.Lock()
+	defer l.UseCaseMutex.Unlock()
+
+	mapLimitValue, ok := l.CacheLimit[id]
+	if ok {
+		return mapLimitValue, false, nil
+	}
 
-		// Não está no cache mas está no repository
-		mapLimitValue = &MapLimitValue{
-			Data: &limit_entity.Limit{
-				Id:      limitData.Id,
-				FreeAt:  limitData.FreeAt,
-				LastAt:  limitData.LastAt,
-				Counter: limitData.Counter,
-			},
-			Mutex: &sync.Mutex{},
+	// Não está no cache
+	limitData, err := l.LimitRepository.GetLimitById(ctx, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrLimitBackend, err)
+	}
+
+	// Not found, create
+	isNew := limitData == nil
+	if isNew {
+		limitData = &limit_entity.Limit{
+			Id: id,
 		}
-		l.CacheLimit[input.Id] = mapLimitValue
 	}
-	l.UseCaseMutex.Unlock()
 
-	mapLimitValue.Mutex.Lock()
-	defer mapLimitValue.Mutex.Unlock()
+	mapLimitValue = &MapLimitValue{
+		Data:  limitData.Clone(),
+		Mutex: &sync.Mutex{},
+	}
+	l.CacheLimit[id] = mapLimitValue
+
+	return mapLimitValue, isNew, nil
+}
+
+// evaluate aplica o bloqueio e, fora dele, delega a decisão ao algoritmo
+func (l *LimitUseCase) evaluate(algorithm limitAlgorithmFunc, limit *limit_entity.Limit, input LimitInputDTO, now time.Time) bool {
 	// Está com bloqueio
-	if mapLimitValue.Data.FreeAt != nil {
-		// Já passou o tempo de bloqueio
-		if mapLimitValue.Data.FreeAt.Before(time.Now()) {
-			*l.CacheLimit[input.Id].Data = limit_entity.Limit{
-				Id:      mapLimitValue.Data.Id,
-				FreeAt:  nil,
-				LastAt:  time.Now(),
-				Counter: 1,
+	if limit.FreeAt != nil {
+		// Não passou o tempo de bloqueio
+		// A política decide se o bloqueio é reiniciado. No exponencial Counter conta as
+		// requisições recebidas durante o bloqueio, a que bloqueou inclusive.
+		if !limit.FreeAt.Before(now) {
+			policy := normalizeBlockPolicy(input.BlockPolicy)
+			if policy == BlockPolicyExponential {
+				limit.Counter++
+			}
+			t := limit_entity.BlockedUntil(string(policy), *limit.FreeAt, now,
+				penaltyBlockTime(input, limit.Offenses), MAX_BLOCK_DURATION, limit.Counter)
+			limit.FreeAt = &t
+			limit.LastAt = now
+			// A penalidade decai a partir do fim do bloqueio, que pode ter mudado
+			if limit.Offenses > 0 {
+				limit.OffenseAt = t
 			}
 
-			return LimitOutputDTO{Pass: true}, nil
+			return false
 		}
-		// Não passou o tempo de bloqueio
-		// Vou ser mal e reiniciar o tempo de bloqueio
 
-		t := time.Now().Add(time.Duration(input.BlockTimeBySec) * time.Second)
-		l.CacheLimit[input.Id].Data.FreeAt = &t
-		l.CacheLimit[input.Id].Data.LastAt = time.Now()
+		// Já passou o tempo de bloqueio, começa do zero, menos a penalidade
+		*limit = limit_entity.Limit{
+			Id:        limit.Id,
+			Offenses:  limit.Offenses,
+			OffenseAt: limit.OffenseAt,
+		}
+	}
 
-		return LimitOutputDTO{Pass: false}, nil
+	if algorithm(limit, input, now) {
+		return true
 	}
 
-	// Passou um segundo sem requisição
-	if time.Since(mapLimitValue.Data.LastAt) > time.Second {
+	// Sem tempo de bloqueio só nega, preservando o estado do algoritmo
+	if input.BlockTimeBySec <= 0 {
+		return false
+	}
 
-		*l.CacheLimit[input.Id].Data = limit_entity.Limit{
-			Id:      mapLimitValue.Data.Id,
-			FreeAt:  nil,
-			LastAt:  time.Now(),
-			Counter: 1,
-		}
+	// Atingiu o limite, bloqueia pelo tempo do nível de penalidade
+	offenses := limit_entity.NextOffense(limit.Offenses, limit.OffenseAt, now, input.PenaltyDecay)
+	t := now.Add(penaltyBlockTime(input, offenses))
+	*limit = limit_entity.Limit{
+		Id:       limit.Id,
+		FreeAt:   &t,
+		LastAt:   now,
+		Counter:  1,
+		Offenses: offenses,
+	}
+	if offenses > 0 {
+		limit.OffenseAt = t
+	}
+
+	return false
+}
+
+// CachedLimit devolve uma cópia do estado em cache do id, que é mais novo que o do repository
+func (l *LimitUseCase) CachedLimit(id string) (*limit_entity.Limit, bool) {
+	l.ClearMutex.RLock()
+	defer l.ClearMutex.RUnlock()
 
-		return LimitOutputDTO{Pass: true}, nil
+	l.UseCaseMutex.Lock()
+	mapLimitValue, ok := l.CacheLimit[id]
+	l.UseCaseMutex.Unlock()
+
+	if !ok {
+		return nil, false
 	}
 
-	// Atingiu o máximo de requisições por segundo
-	if mapLimitValue.Data.Counter+1 > input.ReqsBySec {
-		t := time.Now().Add(time.Duration(input.BlockTimeBySec) * time.Second)
+	mapLimitValue.Mutex.Lock()
+	defer mapLimitValue.Mutex.Unlock()
 
-		*l.CacheLimit[input.Id].Data = limit_entity.Limit{
-			Id:      mapLimitValue.Data.Id,
-			FreeAt:  &t,
-			LastAt:  time.Now(),
-			Counter: 1,
-		}
+	return mapLimitValue.Data.Clone(), true
+}
+
+// InvalidateLimit roda update com as execuções paradas e tira o id do cache. update recebe
+// uma cópia do estado em cache, nil se não estiver. Assim a próxima execução lê o que update
+// gravou no repository, em vez do cache sobrescrever a mudança. O cache das outras
+// instâncias do servidor não é afetado.
+func (l *LimitUseCase) InvalidateLimit(id string, update func(cached *limit_entity.Limit) error) error {
+	l.ClearMutex.Lock()
+	defer l.ClearMutex.Unlock()
+
+	l.UseCaseMutex.Lock()
+	defer l.UseCaseMutex.Unlock()
 
-		return LimitOutputDTO{Pass: false}, nil
+	var cached *limit_entity.Limit
+	if mapLimitValue, ok := l.CacheLimit[id]; ok {
+		cached = mapLimitValue.Data.Clone()
 	}
 
-	// Incrementa o counter e ok
-	*l.CacheLimit[input.Id].Data = limit_entity.Limit{
-		Id:      mapLimitValue.Data.Id,
-		FreeAt:  nil,
-		LastAt:  time.Now(),
-		Counter: mapLimitValue.Data.Counter + 1,
+	if err := update(cached); err != nil {
+		return err
 	}
 
-	return LimitOutputDTO{Pass: true}, nil
+	delete(l.CacheLimit, id)
 
+	return nil
 }
@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -23,10 +24,14 @@ func (suite *LimitUseCaseTestSuite) SetupTest() {
 	suite.LimitRepository = LimitRepository
 }
 
+func (suite *LimitUseCaseTestSuite) TearDownTest() {
+	suite.Sut.Close()
+}
+
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_one_single_request() {
 	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             "IP",
-		ReqsBySec:      5,
+		MaxReqs:        5,
 		BlockTimeBySec: 5,
 	})
 	suite.Nil(err)
@@ -37,7 +42,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_one_single_requ
 	myID := "IP"
 	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      5,
+		MaxReqs:        5,
 		BlockTimeBySec: 5,
 	})
 	suite.Nil(err)
@@ -54,7 +59,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_two_same_reques
 
 	output1, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -64,7 +69,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_two_same_reques
 
 	output2, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -91,7 +96,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output1, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -102,7 +107,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output2, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -113,7 +118,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output3, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -124,7 +129,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output4, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -135,7 +140,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output5, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -146,7 +151,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 
 	output6, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
 		Id:             myID,
-		ReqsBySec:      int32(reqsBySec),
+		MaxReqs:        int32(reqsBySec),
 		BlockTimeBySec: int32(blockTimeBySec),
 	})
 	suite.Nil(err)
@@ -170,7 +175,7 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_after_five_sam
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_third_request_after_one_second() {
 	limitInput := LimitInputDTO{
 		Id:             "IP",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
@@ -202,19 +207,19 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_third_request_a
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_three_concurrent_requests_and_cachelimit_has_three() {
 	limitInput1 := LimitInputDTO{
 		Id:             "IP.01",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput2 := LimitInputDTO{
 		Id:             "IP.02",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput3 := LimitInputDTO{
 		Id:             "IP.03",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
@@ -263,19 +268,19 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_three_concurren
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_three_concurrent_requests_and_after_ten_seconds_update_limit_on_repository() {
 	limitInput1 := LimitInputDTO{
 		Id:             "IP.01",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput2 := LimitInputDTO{
 		Id:             "IP.02",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput3 := LimitInputDTO{
 		Id:             "IP.03",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
@@ -348,19 +353,19 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_three_concurren
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_three_concurrent_requests_and_after_ten_seconds_update_limit_on_repository_and_pass_again_three_concurrent_requests() {
 	limitInput1 := LimitInputDTO{
 		Id:             "IP.01",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput2 := LimitInputDTO{
 		Id:             "IP.02",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput3 := LimitInputDTO{
 		Id:             "IP.03",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
@@ -478,19 +483,19 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_clean_cachelimit_aft
 func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_lock_requests_while_clear_is_running_and_must_pass_normal_rate_request() {
 	limitInput1 := LimitInputDTO{
 		Id:             "IP.01",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput2 := LimitInputDTO{
 		Id:             "IP.02",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
 	limitInput3 := LimitInputDTO{
 		Id:             "IP.03",
-		ReqsBySec:      2,
+		MaxReqs:        2,
 		BlockTimeBySec: 5,
 	}
 
@@ -565,6 +570,596 @@ func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_lock_requests_while_
 	suite.NotNil(myLimit3.FreeAt)
 }
 
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_block_sliding_window_log_burst_across_second_boundary() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        3,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	output1, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output1.Pass)
+	suite.Equal(1, len(suite.Sut.CacheLimit[limitInput.Id].Data.Timestamps))
+
+	time.Sleep(600 * time.Millisecond)
+
+	output2, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output2.Pass)
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output3.Pass)
+	suite.Equal(3, len(suite.Sut.CacheLimit[limitInput.Id].Data.Timestamps))
+
+	time.Sleep(600 * time.Millisecond)
+
+	// A primeira requisição saiu da janela, as outras duas ainda não
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output4.Pass)
+	suite.Equal(int32(3), suite.Sut.CacheLimit[limitInput.Id].Data.Counter)
+	suite.Nil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output5.Pass)
+	suite.NotNil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_sliding_window_log_requests_and_after_ten_seconds_update_limit_on_repository() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	time.Sleep(15 * time.Second)
+
+	suite.Equal(0, len(suite.Sut.CacheLimit))
+
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Equal(limitInput.Id, myLimit.Id)
+	suite.Equal(int32(2), myLimit.Counter)
+	suite.Equal(2, len(myLimit.Timestamps))
+	suite.Nil(myLimit.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_return_error_for_unknown_algorithm() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+		Algorithm:      LimitAlgorithm("unknown"),
+	})
+	suite.NotNil(err)
+	suite.False(output.Pass)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_token_bucket_burst_and_refill_at_rate() {
+	limitInput := LimitInputDTO{
+		Id:             "TOKEN",
+		MaxReqs:        2,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmTokenBucket,
+		Burst:          4,
+	}
+
+	// O balde começa cheio e aceita o burst acima da taxa
+	for range 4 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.Less(suite.Sut.CacheLimit[limitInput.Id].Data.Tokens, float64(1))
+
+	// Pouco mais de meio segundo repõe uma ficha
+	time.Sleep(600 * time.Millisecond)
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output5.Pass)
+	suite.Nil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+
+	output6, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output6.Pass)
+	suite.NotNil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_deny_token_bucket_without_blocking_when_block_time_is_zero() {
+	limitInput := LimitInputDTO{
+		Id:             "TOKEN",
+		MaxReqs:        1,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmTokenBucket,
+		Burst:          2,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output3.Pass)
+	suite.Nil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+
+	// O estado não é descartado, o balde continua vazio
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output4.Pass)
+
+	time.Sleep(1 * time.Second)
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output5.Pass)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_weight_previous_window_in_sliding_window_counter() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        4,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowCounter,
+		Window:         2 * time.Second,
+	}
+
+	// Começa no início de uma janela para não depender do relógio
+	time.Sleep(time.Until(time.Now().Truncate(limitInput.Window).Add(limitInput.Window)))
+
+	for range 4 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output5, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output5.Pass)
+
+	// Metade da janela seguinte: a anterior ainda pesa pouco menos de 4 * 0.5
+	time.Sleep(time.Until(time.Now().Truncate(limitInput.Window).Add(limitInput.Window + limitInput.Window/2)))
+
+	output6, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output6.Pass)
+	suite.Equal(int32(4), suite.Sut.CacheLimit[limitInput.Id].Data.PrevCounter)
+
+	output7, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output7.Pass)
+
+	output8, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output8.Pass)
+	suite.Equal(int32(2), suite.Sut.CacheLimit[limitInput.Id].Data.Counter)
+	suite.Nil(suite.Sut.CacheLimit[limitInput.Id].Data.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_reset_sliding_window_counter_after_two_idle_windows() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowCounter,
+		Window:         500 * time.Millisecond,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output3.Pass)
+	suite.Equal(int32(0), suite.Sut.CacheLimit[limitInput.Id].Data.PrevCounter)
+	suite.Equal(int32(1), suite.Sut.CacheLimit[limitInput.Id].Data.Counter)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_pass_sliding_window_counter_requests_and_after_ten_seconds_update_limit_on_repository() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        5,
+		BlockTimeBySec: 5,
+		Algorithm:      AlgorithmSlidingWindowCounter,
+		Window:         time.Minute,
+	}
+
+	for range 3 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	time.Sleep(15 * time.Second)
+
+	suite.Equal(0, len(suite.Sut.CacheLimit))
+
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Equal(limitInput.Id, myLimit.Id)
+	suite.Equal(int32(3), myLimit.Counter)
+	suite.False(myLimit.WindowStart.IsZero())
+	suite.Nil(myLimit.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_count_fixed_window_requests_within_the_configured_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		Window:         2 * time.Second,
+		BlockTimeBySec: 0,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	// Depois de um segundo a janela de dois segundos ainda não terminou
+	time.Sleep(1100 * time.Millisecond)
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output3.Pass)
+
+	time.Sleep(2100 * time.Millisecond)
+
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output4.Pass)
+	suite.Equal(int32(1), suite.Sut.CacheLimit[limitInput.Id].Data.Counter)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_keep_sliding_window_log_timestamps_for_the_configured_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		Window:         time.Minute,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output3.Pass)
+	suite.Equal(2, len(suite.Sut.CacheLimit[limitInput.Id].Data.Timestamps))
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_deny_when_any_stacked_tier_is_exceeded_and_report_the_tier() {
+	limitInput := LimitInputDTO{
+		Id: "TOKEN",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 3, Window: time.Second},
+			{Name: "minute", MaxReqs: 5, Window: time.Minute},
+		},
+	}
+
+	for range 3 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+		suite.Equal("", output.Tier)
+	}
+
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output4.Pass)
+	suite.Equal("second", output4.Tier)
+
+	// A requisição negada não conta no tier de minuto
+	suite.Equal(int32(3), suite.Sut.CacheLimit["TOKEN:minute"].Data.Counter)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output7, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output7.Pass)
+	suite.Equal("minute", output7.Tier)
+	suite.Equal(int32(5), suite.Sut.CacheLimit["TOKEN:minute"].Data.Counter)
+	suite.Equal(int32(2), suite.Sut.CacheLimit["TOKEN:second"].Data.Counter)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_keep_denying_while_a_stacked_tier_is_blocked() {
+	limitInput := LimitInputDTO{
+		Id: "TOKEN",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 2, Window: time.Second, BlockTimeBySec: 5},
+			{Name: "day", MaxReqs: 100, Window: 24 * time.Hour},
+		},
+	}
+
+	for range 2 {
+		output, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	output3, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output3.Pass)
+	suite.Equal("second", output3.Tier)
+	suite.NotNil(suite.Sut.CacheLimit["TOKEN:second"].Data.FreeAt)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	output4, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output4.Pass)
+	suite.Equal("second", output4.Tier)
+	suite.Equal(int32(2), suite.Sut.CacheLimit["TOKEN:day"].Data.Counter)
+	suite.Nil(suite.Sut.CacheLimit["TOKEN:day"].Data.FreeAt)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_return_error_for_duplicated_tier_names() {
+	output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+		Id: "TOKEN",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 2, Window: time.Second},
+			{Name: "second", MaxReqs: 5, Window: time.Second},
+		},
+	})
+	suite.NotNil(err)
+	suite.False(output.Pass)
+	suite.Equal(0, len(suite.Sut.CacheLimit))
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_report_limit_remaining_and_reset_with_fixed_window() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        3,
+		BlockTimeBySec: 5,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(3), output.Limit)
+	suite.Equal(int32(2), output.Remaining)
+	suite.Equal(time.Second, output.Reset)
+	suite.Equal(time.Duration(0), output.RetryAfter)
+
+	for range 2 {
+		output, err = suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+	suite.Equal(int32(0), output.Remaining)
+
+	// Bloqueado, só libera depois do tempo de bloqueio
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(3), output.Limit)
+	suite.Equal(int32(0), output.Remaining)
+	suite.Equal(5*time.Second, output.RetryAfter)
+	suite.Equal(5*time.Second, output.Reset)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_report_retry_after_when_token_bucket_is_empty() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmTokenBucket,
+		Burst:          4,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(4), output.Limit)
+	suite.Equal(int32(3), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.Reset, float64(10*time.Millisecond))
+
+	for range 3 {
+		output, err = suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+		suite.True(output.Pass)
+	}
+
+	// 2 tokens por segundo, um token a cada 500ms
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+	suite.InDelta(500*time.Millisecond, output.RetryAfter, float64(10*time.Millisecond))
+	suite.InDelta(2*time.Second, output.Reset, float64(20*time.Millisecond))
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_report_retry_after_when_sliding_window_log_denies() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        2,
+		BlockTimeBySec: 0,
+		Algorithm:      AlgorithmSlidingWindowLog,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	time.Sleep(300 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(0), output.Remaining)
+
+	// Passa quando a primeira sair da janela, o limite fica inteiro quando a segunda sair
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.InDelta(700*time.Millisecond, output.RetryAfter, float64(50*time.Millisecond))
+	suite.InDelta(time.Second, output.Reset, float64(50*time.Millisecond))
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_report_tier_closest_to_deny() {
+	limitInput := LimitInputDTO{
+		Id: "IP",
+		Tiers: []LimitTierDTO{
+			{Name: "second", MaxReqs: 5, Window: time.Second},
+			{Name: "minute", MaxReqs: 2, Window: time.Minute},
+		},
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(2), output.Limit)
+	suite.Equal(int32(1), output.Remaining)
+	suite.Equal(time.Minute, output.Reset)
+	suite.Equal("", output.Tier)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_apply_the_block_policy() {
+	runLimiterCases(&suite.Suite, suite.Sut, blockPolicyCases)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_penalize_repeat_offenders() {
+	runLimiterCases(&suite.Suite, suite.Sut, penaltyCases)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_keep_offenses_in_the_repository_across_restarts() {
+	limitInput := LimitInputDTO{
+		Id:             "IP",
+		MaxReqs:        1,
+		BlockTimeBySec: 1,
+		PenaltyDecay:   10 * time.Second,
+	}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.Equal(int32(1), output.OffenseLevel)
+
+	// Close grava o cache no repository, a nova instância parte só do que está lá
+	suite.Sut.Close()
+	suite.Sut = NewLimitUseCase(suite.LimitRepository)
+
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Equal(int32(1), myLimit.Offenses)
+
+	time.Sleep(1100 * time.Millisecond)
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Equal(int32(1), output.OffenseLevel)
+
+	output, err = suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.False(output.Pass)
+	suite.InDelta(6*time.Second, output.RetryAfter, float64(50*time.Millisecond))
+	suite.Equal(int32(2), output.OffenseLevel)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_keep_repository_bounded_under_a_stream_of_unique_ips() {
+	suite.LimitRepository.SweepInterval = 100 * time.Millisecond
+
+	// Três segundos de IPs que nunca voltam, mil por segundo com janela de um segundo
+	for i := range 3000 {
+		output, err := suite.Sut.Execute(context.Background(), LimitInputDTO{
+			Id:             fmt.Sprintf("IP.%d", i),
+			MaxReqs:        5,
+			BlockTimeBySec: 5,
+		})
+		suite.Nil(err)
+		suite.True(output.Pass)
+
+		if i%100 == 99 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	// Só ficam os IPs da última janela, mais o que chegou desde a última varredura
+	suite.LimitRepository.Mutex.Lock()
+	size := len(suite.LimitRepository.Db)
+	suite.LimitRepository.Mutex.Unlock()
+	suite.LessOrEqual(size, 1500)
+
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), "IP.0")
+	suite.Nil(err)
+	suite.Nil(myLimit)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_keep_blocked_limit_in_the_repository_until_the_block_ends() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 2, BlockTimeBySec: 12}
+
+	for range 3 {
+		_, err := suite.Sut.Execute(context.Background(), limitInput)
+		suite.Nil(err)
+	}
+	suite.Sut.Close()
+
+	// A janela e o ciclo seguinte à gravação já passaram, mas o bloqueio ainda decide
+	time.Sleep(11 * time.Second)
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.NotNil(myLimit.FreeAt)
+
+	time.Sleep(1300 * time.Millisecond)
+	myLimit, err = suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Nil(myLimit)
+}
+
+func (suite *LimitUseCaseTestSuite) TestLimitUseCase_Should_drop_flushed_state_one_cycle_after_the_flush() {
+	limitInput := LimitInputDTO{Id: "IP", MaxReqs: 2, BlockTimeBySec: 5}
+
+	output, err := suite.Sut.Execute(context.Background(), limitInput)
+	suite.Nil(err)
+	suite.True(output.Pass)
+	suite.Sut.Close()
+
+	// A janela de um segundo acabou, mas o estado gravado fica até o próximo ciclo
+	time.Sleep(1100 * time.Millisecond)
+	myLimit, err := suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Equal(int32(1), myLimit.Counter)
+
+	time.Sleep(TIMER_DURATION)
+	myLimit, err = suite.LimitRepository.GetLimitById(context.Background(), limitInput.Id)
+	suite.Nil(err)
+	suite.Nil(myLimit)
+}
+
 func TestLimitUseCaseTestSuite(t *testing.T) {
 	suite.Run(t, new(LimitUseCaseTestSuite))
 }
@@ -0,0 +1,269 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// limiterCase é um comportamento comum aos Limiters, rodado pela suite de cada um. id é a
+// chave do caso, assim o estado de um caso não interfere no seguinte.
+type limiterCase struct {
+	name string
+	run  func(s *suite.Suite, sut Limiter, id string)
+}
+
+func runLimiterCases(s *suite.Suite, sut Limiter, cases []limiterCase) {
+	for i, c := range cases {
+		s.Run(c.name, func() {
+			c.run(s, sut, fmt.Sprintf("IP-%d", i))
+		})
+	}
+}
+
+// blockPolicyCases são as políticas de bloqueio, iguais em todos os Limiters
+var blockPolicyCases = []limiterCase{
+	{
+		name: "return error for unknown block policy",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			output, err := sut.Execute(context.Background(), LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				BlockPolicy:    "forever",
+			})
+			s.NotNil(err)
+			s.False(output.Pass)
+		},
+	},
+	{
+		name: "keep block end with fixed block policy",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				BlockPolicy:    BlockPolicyFixed,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+
+			// A requisição durante o bloqueio não muda o fim dele
+			time.Sleep(600 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(400*time.Millisecond, output.RetryAfter, float64(100*time.Millisecond))
+
+			time.Sleep(500 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+		},
+	},
+	{
+		name: "restart block with extend block policy",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				BlockPolicy:    BlockPolicyExtend,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+
+			time.Sleep(600 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(time.Second, output.RetryAfter, float64(100*time.Millisecond))
+
+			time.Sleep(500 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+		},
+	},
+	{
+		name: "double block with exponential block policy",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				BlockPolicy:    BlockPolicyExponential,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(2*time.Second, output.RetryAfter, float64(50*time.Millisecond))
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(4*time.Second, output.RetryAfter, float64(50*time.Millisecond))
+		},
+	},
+	{
+		name: "move the penalty decay when the block is extended",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				BlockPolicy:    BlockPolicyExtend,
+				PenaltyDecay:   time.Second,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.Equal(int32(1), output.OffenseLevel)
+
+			// Reinicia o bloqueio, que agora acaba em 1.9s
+			time.Sleep(900 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+
+			// O decay conta do fim do bloqueio estendido, contado do primeiro já teria acabado
+			time.Sleep(1500 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+			s.Equal(int32(1), output.OffenseLevel)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.Equal(int32(2), output.OffenseLevel)
+			s.InDelta(6*time.Second, output.RetryAfter, float64(50*time.Millisecond))
+		},
+	},
+}
+
+// penaltyCases são as penalidades progressivas, iguais em todos os Limiters
+var penaltyCases = []limiterCase{
+	{
+		name: "multiply block time for repeat offenders",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				PenaltyDecay:   10 * time.Second,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+			s.Equal(int32(0), output.OffenseLevel)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+			s.Equal(int32(1), output.OffenseLevel)
+
+			// O bloqueio acabou mas a penalidade continua em vigor
+			time.Sleep(1100 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+			s.Equal(int32(1), output.OffenseLevel)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(6*time.Second, output.RetryAfter, float64(50*time.Millisecond))
+			s.Equal(int32(2), output.OffenseLevel)
+		},
+	},
+	{
+		name: "forget offenses after the penalty decay",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+				PenaltyDecay:   500 * time.Millisecond,
+			}
+
+			output, err := sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.Equal(int32(1), output.OffenseLevel)
+
+			// O decay conta a partir do fim do bloqueio
+			time.Sleep(1700 * time.Millisecond)
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.True(output.Pass)
+			s.Equal(int32(0), output.OffenseLevel)
+
+			output, err = sut.Execute(context.Background(), limitInput)
+			s.Nil(err)
+			s.False(output.Pass)
+			s.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+			s.Equal(int32(1), output.OffenseLevel)
+		},
+	},
+	{
+		name: "not track offenses without penalty decay",
+		run: func(s *suite.Suite, sut Limiter, id string) {
+			limitInput := LimitInputDTO{
+				Id:             id,
+				MaxReqs:        1,
+				BlockTimeBySec: 1,
+			}
+
+			for range 2 {
+				output, err := sut.Execute(context.Background(), limitInput)
+				s.Nil(err)
+				s.True(output.Pass)
+
+				output, err = sut.Execute(context.Background(), limitInput)
+				s.Nil(err)
+				s.False(output.Pass)
+				s.InDelta(time.Second, output.RetryAfter, float64(50*time.Millisecond))
+				s.Equal(int32(0), output.OffenseLevel)
+
+				time.Sleep(1100 * time.Millisecond)
+			}
+		},
+	},
+}